@@ -19,6 +19,13 @@ import (
 
 func main() {
 	log.SetFlags(log.Flags() | log.Lmicroseconds)
+	linter.DeclareCheck(linter.CheckInfo{
+		Name:    "strictCmp",
+		Default: linter.LevelWarning,
+		Comment: "Report non-strict comparison of strings.",
+		Before:  `if ($s == "abc") {}`,
+		After:   `if ($s === "abc") {}`,
+	})
 	linter.RegisterBlockChecker(func(ctx *linter.BlockContext) linter.BlockChecker { return &block{ctx: ctx} })
 	cmd.Main()
 }
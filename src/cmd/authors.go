@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/VKCOM/noverify/src/linter"
+)
+
+// unknownAuthor is used for reports on lines that were not changed by any of the analyzed commits,
+// e.g. when a change in one place causes a new report in another one.
+const unknownAuthor = "(unknown author)"
+
+func reportAuthor(r *linter.Report) string {
+	if c := r.Commit(); c != nil && c.Author != "" {
+		return c.Author
+	}
+	return unknownAuthor
+}
+
+// checkAuthorFlags returns an error if reports can not be grouped or filtered by author with current flags.
+// Commits of reports are only known when committed changes are analyzed, so reports of local changes
+// and trend counts would all be filtered out.
+func checkAuthorFlags(command string) error {
+	if (gitGroupByAuthor || gitAuthorFilter != "") && gitRepo == "" {
+		return errors.New("-git-group-by-author and -git-author-filter can only be used in git mode")
+	}
+	if gitAuthorFilter != "" && (gitWorkTree != "" || gitStaged || command == "trend") {
+		return errors.New("-git-author-filter can not be used with -git-work-tree, -git-staged and trend command")
+	}
+	return nil
+}
+
+func buildAuthorFilter() {
+	if gitAuthorFilter == "" {
+		return
+	}
+
+	gitAuthorFilterSet = make(map[string]bool)
+	for _, name := range strings.Split(gitAuthorFilter, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			gitAuthorFilterSet[name] = true
+		}
+	}
+}
+
+// groupReportsByAuthor sorts reports by author name keeping their order for each author.
+// Reports of unknown authors go last.
+func groupReportsByAuthor(reports []*linter.Report) {
+	sort.SliceStable(reports, func(i, j int) bool {
+		a, b := reportAuthor(reports[i]), reportAuthor(reports[j])
+		if (a == unknownAuthor) != (b == unknownAuthor) {
+			return b == unknownAuthor
+		}
+		return a < b
+	})
+}
+
+func countReportsByAuthor(reports []*linter.Report) map[string]int {
+	res := make(map[string]int)
+	for _, r := range reports {
+		res[reportAuthor(r)]++
+	}
+	return res
+}
@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"testing"
+)
+
+func TestCheckAuthorFlags(t *testing.T) {
+	defer func() {
+		gitRepo, gitWorkTree, gitStaged, gitAuthorFilter, gitGroupByAuthor = "", "", false, "", false
+	}()
+
+	tests := []struct {
+		repo     string
+		workTree string
+		staged   bool
+		filter   string
+		group    bool
+		command  string
+		ok       bool
+	}{
+		{repo: ".git", filter: "alice", ok: true},
+		{repo: ".git", group: true, workTree: ".", ok: true},
+		{filter: "alice", ok: false},
+		{group: true, ok: false},
+		{repo: ".git", workTree: ".", filter: "alice", ok: false},
+		{repo: ".git", staged: true, filter: "alice", ok: false},
+		{repo: ".git", filter: "alice", command: "trend", ok: false},
+		{repo: ".git", command: "trend", ok: true},
+	}
+
+	for _, tc := range tests {
+		gitRepo, gitWorkTree, gitStaged, gitAuthorFilter, gitGroupByAuthor = tc.repo, tc.workTree, tc.staged, tc.filter, tc.group
+
+		err := checkAuthorFlags(tc.command)
+		if (err == nil) != tc.ok {
+			t.Errorf("%+v: unexpected error %v", tc, err)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package cmd
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/VKCOM/noverify/src/linter"
+)
+
+const baselineVersion = 1
+
+// baselineEntry describes identical reports that are known and must not be shown.
+// Line numbers are intentionally not stored so that entries survive code movement.
+type baselineEntry struct {
+	Filename  string `json:"filename"`
+	CheckName string `json:"check_name"`
+	Message   string `json:"message"`
+	LineHash  string `json:"line_hash"`
+	Count     int    `json:"count"`
+}
+
+type baselineFile struct {
+	Version int             `json:"version"`
+	Entries []baselineEntry `json:"entries"`
+}
+
+type baselineKey struct {
+	filename  string
+	checkName string
+	message   string
+	lineHash  string
+}
+
+// baseline suppresses reports that are listed in baseline file.
+// It also counts matched entries so that stale ones could be found afterwards.
+type baseline struct {
+	entries map[baselineKey]*baselineEntry
+	used    map[baselineKey]int
+}
+
+// baselineFilename converts absolute paths to paths relative to working directory
+// so that baseline does not depend on where the project is checked out.
+func baselineFilename(filename string) string {
+	if !filepath.IsAbs(filename) {
+		return filepath.ToSlash(filename)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return filepath.ToSlash(filename)
+	}
+
+	rel, err := filepath.Rel(wd, filename)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(filename)
+	}
+
+	return filepath.ToSlash(rel)
+}
+
+// baselineLineHash hashes source line without indentation.
+func baselineLineHash(ln string) string {
+	return fmt.Sprintf("%x", md5.Sum([]byte(strings.TrimSpace(ln))))
+}
+
+// less orders baseline keys in the same way as entries are written to baseline file.
+func (k baselineKey) less(other baselineKey) bool {
+	if k.filename != other.filename {
+		return k.filename < other.filename
+	}
+	if k.checkName != other.checkName {
+		return k.checkName < other.checkName
+	}
+	if k.message != other.message {
+		return k.message < other.message
+	}
+	return k.lineHash < other.lineHash
+}
+
+func (e *baselineEntry) key() baselineKey {
+	return baselineKey{filename: e.Filename, checkName: e.CheckName, message: e.Message, lineHash: e.LineHash}
+}
+
+func newBaselineKey(r *linter.Report) baselineKey {
+	return baselineKey{
+		filename:  baselineFilename(r.GetFilename()),
+		checkName: r.CheckName(),
+		message:   r.Message(),
+		lineHash:  baselineLineHash(r.SourceLine()),
+	}
+}
+
+// createBaseline writes all reports that are not excluded into baseline file.
+func createBaseline(filename string, reports []*linter.Report) (count int, err error) {
+	entries := make(map[baselineKey]*baselineEntry)
+	var keys []baselineKey
+
+	for _, r := range reports {
+		if isExcluded(r) {
+			continue
+		}
+
+		key := newBaselineKey(r)
+		e, ok := entries[key]
+		if !ok {
+			e = &baselineEntry{
+				Filename:  key.filename,
+				CheckName: key.checkName,
+				Message:   key.message,
+				LineHash:  key.lineHash,
+			}
+			entries[key] = e
+			keys = append(keys, key)
+		}
+		e.Count++
+		count++
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i].less(keys[j]) })
+
+	out := baselineFile{Version: baselineVersion, Entries: make([]baselineEntry, 0, len(keys))}
+	for _, key := range keys {
+		out.Entries = append(out.Entries, *entries[key])
+	}
+
+	data, err := json.MarshalIndent(&out, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+
+	return count, ioutil.WriteFile(filename, append(data, '\n'), 0666)
+}
+
+func loadBaseline(filename string) (*baseline, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var f baselineFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+
+	if f.Version != baselineVersion {
+		return nil, fmt.Errorf("unsupported baseline version %d, expected %d", f.Version, baselineVersion)
+	}
+
+	b := &baseline{
+		entries: make(map[baselineKey]*baselineEntry, len(f.Entries)),
+		used:    make(map[baselineKey]int),
+	}
+
+	for i := range f.Entries {
+		e := &f.Entries[i]
+		key := e.key()
+		if prev, ok := b.entries[key]; ok {
+			prev.Count += e.Count
+			continue
+		}
+		b.entries[key] = e
+	}
+
+	return b, nil
+}
+
+// suppress reports whether or not report is present in baseline.
+func (b *baseline) suppress(r *linter.Report) bool {
+	key := newBaselineKey(r)
+
+	e, ok := b.entries[key]
+	if !ok || b.used[key] >= e.Count {
+		return false
+	}
+
+	b.used[key]++
+	return true
+}
+
+// reset forgets matched reports, so that the same reports could be suppressed again.
+func (b *baseline) reset() {
+	b.used = make(map[baselineKey]int)
+}
+
+// stale returns baseline entries that did not match any reports (or matched less times than recorded).
+// Count field of returned entries contains the number of unmatched reports.
+func (b *baseline) stale() []baselineEntry {
+	var res []baselineEntry
+
+	for key, e := range b.entries {
+		if unused := e.Count - b.used[key]; unused > 0 {
+			stale := *e
+			stale.Count = unused
+			res = append(res, stale)
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i].key().less(res[j].key()) })
+
+	return res
+}
@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/VKCOM/noverify/src/linter"
+)
+
+func testReport(t *testing.T, filename, checkName, msg, ln string) *linter.Report {
+	t.Helper()
+
+	data, err := json.Marshal(map[string]interface{}{
+		"filename":   filename,
+		"check_name": checkName,
+		"msg":        msg,
+		"start_ln":   ln,
+		"start_line": 1,
+		"level":      linter.LevelError,
+	})
+	if err != nil {
+		t.Fatalf("Could not encode report: %v", err)
+	}
+
+	var r linter.Report
+	if err := json.Unmarshal(data, &r); err != nil {
+		t.Fatalf("Could not decode report: %v", err)
+	}
+	return &r
+}
+
+func TestNewBaselineKey(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Could not get working directory: %v", err)
+	}
+
+	outside := filepath.Join(filepath.Dir(wd), "other", "a.php")
+	hash := baselineLineHash("$x = 1;")
+
+	tests := []struct {
+		filename string
+		ln       string
+		expected baselineKey
+	}{
+		{filepath.Join(wd, "src", "a.php"), "$x = 1;", baselineKey{"src/a.php", "unused", "msg", hash}},
+		{"src/a.php", "\t\t$x = 1;", baselineKey{"src/a.php", "unused", "msg", hash}},
+		{"src/a.php", "    $x = 1;  ", baselineKey{"src/a.php", "unused", "msg", hash}},
+		{outside, "$x = 1;", baselineKey{filepath.ToSlash(outside), "unused", "msg", hash}},
+		{"src/a.php", "$x = 2;", baselineKey{"src/a.php", "unused", "msg", baselineLineHash("$x = 2;")}},
+	}
+
+	for _, tc := range tests {
+		if got := newBaselineKey(testReport(t, tc.filename, "unused", "msg", tc.ln)); got != tc.expected {
+			t.Errorf("%s %q: expected key %+v, got %+v", tc.filename, tc.ln, tc.expected, got)
+		}
+	}
+}
+
+func testBaseline(entries ...baselineEntry) *baseline {
+	b := &baseline{
+		entries: make(map[baselineKey]*baselineEntry),
+		used:    make(map[baselineKey]int),
+	}
+	for i := range entries {
+		b.entries[entries[i].key()] = &entries[i]
+	}
+	return b
+}
+
+func TestBaselineSuppress(t *testing.T) {
+	b := testBaseline(
+		baselineEntry{Filename: "a.php", CheckName: "unused", Message: "Unused variable x", LineHash: baselineLineHash("$x = 1;"), Count: 2},
+		baselineEntry{Filename: "a.php", CheckName: "undefined", Message: "Undefined variable y", LineHash: baselineLineHash("echo $y;"), Count: 1},
+	)
+
+	tests := []struct {
+		report   *linter.Report
+		expected bool
+	}{
+		{testReport(t, "a.php", "unused", "Unused variable x", "$x = 1;"), true},
+		{testReport(t, "a.php", "unused", "Unused variable x", "\t\t$x = 1;"), true},
+		{testReport(t, "a.php", "unused", "Unused variable x", "$x = 1;"), false}, // count is exceeded
+		{testReport(t, "b.php", "undefined", "Undefined variable y", "echo $y;"), false},
+		{testReport(t, "a.php", "undefined", "Undefined variable y", "echo $y + 1;"), false},
+		{testReport(t, "a.php", "undefined", "Undefined variable z", "echo $y;"), false},
+		{testReport(t, "a.php", "undefined", "Undefined variable y", "  echo $y;"), true},
+	}
+
+	for i, tc := range tests {
+		if got := b.suppress(tc.report); got != tc.expected {
+			t.Errorf("report %d (%s): expected suppress %v, got %v", i, tc.report, tc.expected, got)
+		}
+	}
+
+	b.reset()
+	if !b.suppress(tests[0].report) {
+		t.Errorf("Report is not suppressed after reset")
+	}
+}
+
+func TestBaselineStale(t *testing.T) {
+	x, y := baselineLineHash("$x = 1;"), baselineLineHash("$y = 1;")
+	lo, hi := x, y
+	if lo > hi {
+		lo, hi = hi, lo
+	}
+
+	tests := []struct {
+		entries  []baselineEntry
+		reports  []*linter.Report
+		expected []baselineEntry
+	}{
+		{
+			entries: []baselineEntry{
+				{Filename: "a.php", CheckName: "unused", Message: "msg", LineHash: x, Count: 3},
+			},
+			reports: []*linter.Report{
+				testReport(t, "a.php", "unused", "msg", "$x = 1;"),
+			},
+			expected: []baselineEntry{
+				{Filename: "a.php", CheckName: "unused", Message: "msg", LineHash: x, Count: 2},
+			},
+		},
+		{
+			entries: []baselineEntry{
+				{Filename: "a.php", CheckName: "unused", Message: "msg", LineHash: x, Count: 1},
+			},
+			reports: []*linter.Report{
+				testReport(t, "a.php", "unused", "msg", "$x = 1;"),
+				testReport(t, "a.php", "unused", "msg", "$x = 1;"),
+			},
+			expected: nil,
+		},
+		{
+			entries: []baselineEntry{
+				{Filename: "b.php", CheckName: "unused", Message: "msg", LineHash: x, Count: 1},
+				{Filename: "a.php", CheckName: "unused", Message: "msg", LineHash: y, Count: 1},
+				{Filename: "a.php", CheckName: "unused", Message: "msg", LineHash: x, Count: 1},
+				{Filename: "a.php", CheckName: "caseBreak", Message: "msg", LineHash: y, Count: 1},
+				{Filename: "a.php", CheckName: "caseBreak", Message: "msg", LineHash: x, Count: 1},
+			},
+			expected: []baselineEntry{
+				{Filename: "a.php", CheckName: "caseBreak", Message: "msg", LineHash: lo, Count: 1},
+				{Filename: "a.php", CheckName: "caseBreak", Message: "msg", LineHash: hi, Count: 1},
+				{Filename: "a.php", CheckName: "unused", Message: "msg", LineHash: lo, Count: 1},
+				{Filename: "a.php", CheckName: "unused", Message: "msg", LineHash: hi, Count: 1},
+				{Filename: "b.php", CheckName: "unused", Message: "msg", LineHash: x, Count: 1},
+			},
+		},
+	}
+
+	for i, tc := range tests {
+		b := testBaseline(tc.entries...)
+		for _, r := range tc.reports {
+			b.suppress(r)
+		}
+
+		got, expected := fmt.Sprintf("%+v", b.stale()), fmt.Sprintf("%+v", tc.expected)
+		if got != expected {
+			t.Errorf("test %d: expected stale entries %s, got %s", i, expected, got)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/VKCOM/noverify/src/linter"
+)
+
+// writeChecksList prints all declared checks as a table.
+func writeChecksList(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "CHECK\tSEVERITY\tDESCRIPTION\n")
+	for _, info := range linter.GetDeclaredChecks() {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", info.Name, linter.SeverityName(info.Default), info.Comment)
+	}
+	tw.Flush()
+}
+
+// writeCheckExplanation prints check description with bad and good code examples.
+func writeCheckExplanation(w io.Writer, name string) error {
+	info, ok := linter.GetDeclaredCheck(name)
+	if !ok {
+		return fmt.Errorf("unknown check %s, use -list-checks to see all checks", name)
+	}
+
+	fmt.Fprintf(w, "%s (default severity: %s)\n\n%s\n", info.Name, linter.SeverityName(info.Default), info.Comment)
+
+	if info.Before != "" {
+		fmt.Fprintf(w, "\nNon-compliant code:\n%s\n", indentExample(info.Before))
+	}
+	if info.After != "" {
+		fmt.Fprintf(w, "\nCompliant code:\n%s\n", indentExample(info.After))
+	}
+
+	return nil
+}
+
+func indentExample(code string) string {
+	return "    " + strings.Replace(strings.TrimSpace(code), "\n", "\n    ", -1)
+}
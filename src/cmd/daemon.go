@@ -0,0 +1,320 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VKCOM/noverify/src/git"
+	"github.com/VKCOM/noverify/src/linter"
+	"github.com/VKCOM/noverify/src/meta"
+)
+
+// daemonSettings are the settings that affect reports and must be the same for the daemon and its clients.
+type daemonSettings struct {
+	StubsDir      string `json:"stubs_dir"`
+	Encoding      string `json:"encoding"`
+	Config        string `json:"config"`
+	ConfigHash    string `json:"config_hash"`
+	CheckSeverity string `json:"check_severity"`
+}
+
+func currentDaemonSettings() daemonSettings {
+	return daemonSettings{
+		StubsDir:      absPath(linter.StubsDir),
+		Encoding:      linter.DefaultEncoding,
+		Config:        configFilename,
+		ConfigHash:    configHash,
+		CheckSeverity: checkSeverity,
+	}
+}
+
+// daemonRequest asks the daemon either to analyze files (Paths are indexed and Filenames are linted)
+// or to compute reports for git changes. All paths must be absolute.
+type daemonRequest struct {
+	Settings     daemonSettings `json:"settings"`
+	KeepContents bool           `json:"keep_contents"`
+	Exclude      string         `json:"exclude"`
+
+	Paths     []string           `json:"paths"`
+	Filenames []string           `json:"filenames"`
+	Git       *gitReportsRequest `json:"git"`
+}
+
+type daemonResponse struct {
+	Error      string           `json:"error,omitempty"`
+	OldReports []*linter.Report `json:"old_reports"`
+	Reports    []*linter.Report `json:"reports"`
+}
+
+// daemonIndex remembers content hashes of indexed files, so that only changed files are indexed again.
+type daemonIndex struct {
+	hashes map[string]string
+}
+
+// sync makes meta info contain exactly the files from read callback (plus stubs) and returns
+// the number of indexed and removed files. Files with the same contents as before are not parsed again.
+func (idx *daemonIndex) sync(read linter.ReadCallback) (changed, deleted int) {
+	start := time.Now()
+	seen := make(map[string]bool)
+
+	meta.SetIndexingComplete(false)
+
+	linter.ParseFilenames(func(ch chan linter.FileInfo) {
+		files := make(chan linter.FileInfo)
+		go func() {
+			read(files)
+			close(files)
+		}()
+
+		for f := range files {
+			contents := f.Contents
+			if contents == nil {
+				var err error
+				contents, err = ioutil.ReadFile(f.Filename)
+				if err != nil {
+					log.Printf("Could not read file %s: %s", f.Filename, err.Error())
+					continue
+				}
+			}
+
+			seen[f.Filename] = true
+
+			hash := fmt.Sprintf("%x", md5.Sum(contents))
+			if idx.hashes[f.Filename] == hash {
+				continue
+			}
+
+			idx.hashes[f.Filename] = hash
+			changed++
+			ch <- linter.FileInfo{Filename: f.Filename, Contents: contents}
+		}
+	})
+
+	meta.Info.Lock()
+	for filename := range idx.hashes {
+		if !seen[filename] {
+			meta.Info.DeleteMetaForFileNonLocked(filename)
+			delete(idx.hashes, filename)
+			deleted++
+		}
+	}
+	meta.Info.Unlock()
+
+	log.Printf("Indexed %d changed files and removed %d files in %s", changed, deleted, time.Since(start))
+	return changed, deleted
+}
+
+// invalidate marks files as indexed with unknown contents, e.g. when they were indexed outside of sync.
+func (idx *daemonIndex) invalidate(filenames []string) {
+	for _, filename := range filenames {
+		idx.hashes[filename] = ""
+	}
+}
+
+type daemon struct {
+	mu    sync.Mutex
+	index daemonIndex
+}
+
+func (d *daemon) analyze(req *daemonRequest) (*daemonResponse, error) {
+	if req.Settings != currentDaemonSettings() {
+		return nil, fmt.Errorf("daemon settings %+v differ from client settings %+v, restart the daemon", currentDaemonSettings(), req.Settings)
+	}
+
+	var exclude *regexp.Regexp
+	if req.Exclude != "" {
+		var err error
+		exclude, err = regexp.Compile(req.Exclude)
+		if err != nil {
+			return nil, fmt.Errorf("incorrect exclude regex: %s", err.Error())
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	linter.KeepReportsContents = req.KeepContents
+
+	if req.Git == nil {
+		reports := computeFullReports(req.Paths, req.Filenames, exclude, func() {
+			d.index.sync(linter.ReadFilenames(req.Paths, nil))
+		})
+		return &daemonResponse{Reports: reports}, nil
+	}
+
+	g := req.Git
+	oldReports, reports := computeGitReports(g, func() {
+		d.index.sync(linter.ReadFilesFromGit(g.Repo, g.IndexCommit, nil))
+	})
+
+	// new versions of changed files were indexed and removed files were deleted from meta outside of sync
+	var changed []string
+	for _, c := range g.Changes {
+		removed := c.Type == git.Deleted || (c.Type == git.Changed && c.OldName != c.NewName)
+		if removed && strings.HasSuffix(c.OldName, ".php") {
+			changed = append(changed, c.OldName)
+		}
+		if c.Type == git.Deleted || !strings.HasSuffix(c.NewName, ".php") {
+			continue
+		}
+		if g.WorkTree != "" {
+			changed = append(changed, filepath.Join(g.WorkTree, c.NewName))
+		} else {
+			changed = append(changed, c.NewName)
+		}
+	}
+	d.index.invalidate(changed)
+
+	return &daemonResponse{OldReports: oldReports, Reports: reports}, nil
+}
+
+func (d *daemon) handleAnalyze(w http.ResponseWriter, r *http.Request) {
+	var resp *daemonResponse
+
+	var req daemonRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err == nil {
+		start := time.Now()
+		resp, err = d.analyze(&req)
+		log.Printf("Processed request in %s", time.Since(start))
+	}
+
+	if err != nil {
+		log.Printf("Bad request: %s", err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+		resp = &daemonResponse{Error: err.Error()}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Could not write response: %s", err.Error())
+	}
+}
+
+// daemonNetwork returns "unix" for socket paths and "tcp" for host:port addresses.
+func daemonNetwork(addr string) string {
+	if strings.Contains(addr, "/") || strings.HasSuffix(addr, ".sock") {
+		return "unix"
+	}
+	return "tcp"
+}
+
+func daemonListen(addr string) (net.Listener, error) {
+	network := daemonNetwork(addr)
+
+	if network == "unix" {
+		// socket file is left behind if the previous daemon was killed
+		if conn, err := net.Dial("unix", addr); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("daemon is already running on %s", addr)
+		}
+		os.Remove(addr)
+	} else {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			return nil, fmt.Errorf("daemon can only listen on localhost, got %s", addr)
+		}
+	}
+
+	return net.Listen(network, addr)
+}
+
+// daemonMain indexes stubs once and then serves analysis requests until killed.
+func daemonMain() {
+	ln, err := daemonListen(daemonAddr)
+	if err != nil {
+		log.Fatalf("Could not listen on %s: %s", daemonAddr, err.Error())
+	}
+
+	linter.InitStubs()
+
+	d := &daemon{index: daemonIndex{hashes: make(map[string]string)}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/analyze", d.handleAnalyze)
+
+	log.Printf("Daemon is listening on %s", daemonAddr)
+	log.Fatalf("Daemon stopped: %v", http.Serve(ln, mux))
+}
+
+// daemonCall sends request to the daemon specified in -daemon-addr.
+func daemonCall(req *daemonRequest) *daemonResponse {
+	req.Settings = currentDaemonSettings()
+	req.KeepContents = linter.KeepReportsContents
+	req.Exclude = reportsExclude
+
+	if req.Git != nil {
+		req.Git.Repo = absPath(req.Git.Repo)
+		req.Git.WorkTree = absPath(req.Git.WorkTree)
+	}
+
+	network := daemonNetwork(daemonAddr)
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, network, daemonAddr)
+			},
+		},
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		log.Fatalf("Could not encode daemon request: %s", err.Error())
+	}
+
+	start := time.Now()
+	httpResp, err := client.Post("http://noverify/analyze", "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Fatalf("Could not connect to daemon: %s", err.Error())
+	}
+	defer httpResp.Body.Close()
+
+	var resp daemonResponse
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		log.Fatalf("Could not decode daemon response: %s", err.Error())
+	}
+
+	if resp.Error != "" {
+		log.Fatalf("Daemon error: %s", resp.Error)
+	}
+
+	log.Printf("Got %d reports from daemon in %s", len(resp.Reports), time.Since(start))
+	return &resp
+}
+
+func absPath(path string) string {
+	if path == "" {
+		return ""
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		log.Fatalf("Could not get absolute path of %s: %s", path, err.Error())
+	}
+	return abs
+}
+
+func absPaths(paths []string) []string {
+	res := make([]string, 0, len(paths))
+	for _, p := range paths {
+		res = append(res, absPath(p))
+	}
+	return res
+}
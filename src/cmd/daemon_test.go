@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/VKCOM/noverify/src/linter"
+	"github.com/VKCOM/noverify/src/meta"
+)
+
+var memoryLimiterOnce sync.Once
+
+// initTestLinter starts memory limiter and resets meta info, as linting is not possible without them.
+func initTestLinter(t *testing.T) {
+	memoryLimiterOnce.Do(func() { go linter.MemoryLimiterThread() })
+
+	meta.ResetInfo()
+	meta.SetIndexingComplete(false)
+}
+
+func reportStrings(reports []*linter.Report) []string {
+	res := make([]string, 0, len(reports))
+	for _, r := range reports {
+		res = append(res, r.String())
+	}
+	sort.Strings(res)
+	return res
+}
+
+func TestDaemonSync(t *testing.T) {
+	dir, err := ioutil.TempDir("", "noverify-daemon")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeFile := func(name, contents string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatalf("Could not write %s: %v", name, err)
+		}
+	}
+
+	writeFile("a.php", "<?php\nfunction a() {\n\tb();\n\tc();\n}\n")
+	writeFile("b.php", "<?php\nfunction b() {}\n")
+	writeFile("c.php", "<?php\nfunction c() {}\n")
+
+	initTestLinter(t)
+	defer meta.ResetInfo()
+
+	paths := []string{dir}
+	d := &daemon{index: daemonIndex{hashes: make(map[string]string)}}
+
+	check := func(wantChanged, wantDeleted int) {
+		t.Helper()
+		changed, deleted := d.index.sync(linter.ReadFilenames(paths, nil))
+		if changed != wantChanged || deleted != wantDeleted {
+			t.Errorf("Got %d changed and %d deleted files, expected %d and %d", changed, deleted, wantChanged, wantDeleted)
+		}
+	}
+
+	check(3, 0)
+	check(0, 0)
+
+	writeFile("b.php", "<?php\nfunction b2() {}\n")
+	writeFile("d.php", "<?php\nfunction d() {\n\tb2();\n}\n")
+	if err := os.Remove(filepath.Join(dir, "c.php")); err != nil {
+		t.Fatalf("Could not remove c.php: %v", err)
+	}
+
+	check(2, 1)
+
+	for fn, want := range map[string]bool{`\a`: true, `\b`: false, `\b2`: true, `\c`: false, `\d`: true} {
+		if _, ok := meta.Info.GetFunction(fn); ok != want {
+			t.Errorf("Function %s is defined: %v, expected %v", fn, ok, want)
+		}
+	}
+
+	settings := currentDaemonSettings()
+	settings.ConfigHash = "edited config"
+	if _, err := d.analyze(&daemonRequest{Settings: settings, Paths: paths, Filenames: paths}); err == nil {
+		t.Errorf("Request with different config is not rejected")
+	}
+
+	resp, err := d.analyze(&daemonRequest{Settings: currentDaemonSettings(), Paths: paths, Filenames: paths})
+	if err != nil {
+		t.Fatalf("Could not analyze: %v", err)
+	}
+
+	initTestLinter(t)
+	reports := computeFullReports(paths, paths, nil, func() {
+		linter.ParseFilenames(linter.ReadFilenames(paths, nil))
+	})
+
+	got, want := reportStrings(resp.Reports), reportStrings(reports)
+	if len(want) == 0 {
+		t.Fatalf("No reports about undefined functions")
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Daemon reports %q differ from full reports %q", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("Daemon report %q differs from full report %q", got[i], want[i])
+		}
+	}
+}
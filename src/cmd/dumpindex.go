@@ -0,0 +1,310 @@
+package cmd
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/VKCOM/noverify/src/linter"
+	"github.com/VKCOM/noverify/src/meta"
+	"github.com/VKCOM/noverify/src/solver"
+)
+
+const indexDumpVersion = 1
+
+// indexDump is the documented schema of "noverify dump-index" output.
+// All lists are sorted by name. Do not rename or remove fields here, add new ones instead.
+type indexDump struct {
+	Version           int                    `json:"version"`
+	Classes           []dumpClass            `json:"classes"`
+	Traits            []dumpClass            `json:"traits"`
+	Functions         []dumpFunction         `json:"functions"`
+	Constants         []dumpConstant         `json:"constants"`
+	FunctionOverrides []dumpFunctionOverride `json:"function_overrides"`
+}
+
+// dumpPosition is a definition position: lines are 1-based, character is 0-based,
+// length is the length of the definition in bytes.
+type dumpPosition struct {
+	Filename  string `json:"filename"`
+	Line      int32  `json:"line"`
+	EndLine   int32  `json:"end_line"`
+	Character int32  `json:"character"`
+	Length    int32  `json:"length"`
+}
+
+// dumpType contains types as they were inferred during indexing (Raw), where lazy types like
+// "\Foo::bar()" or "elem(\Foo[])" are not evaluated yet, and the same types after resolution (Resolved).
+type dumpType struct {
+	Raw      []string `json:"raw"`
+	Resolved []string `json:"resolved"`
+}
+
+type dumpParam struct {
+	Name  string   `json:"name"`
+	IsRef bool     `json:"is_ref"`
+	Type  dumpType `json:"type"`
+}
+
+type dumpFunction struct {
+	Name       string       `json:"name"`
+	Access     string       `json:"access"`
+	Params     []dumpParam  `json:"params"`
+	MinParams  int          `json:"min_params"`
+	ReturnType dumpType     `json:"return_type"`
+	ExitFlags  int          `json:"exit_flags"`
+	Position   dumpPosition `json:"position"`
+}
+
+type dumpProperty struct {
+	Name     string       `json:"name"`
+	Static   bool         `json:"static"`
+	Access   string       `json:"access"`
+	Type     dumpType     `json:"type"`
+	Position dumpPosition `json:"position"`
+}
+
+type dumpConstant struct {
+	Name     string       `json:"name"`
+	Access   string       `json:"access"`
+	Type     dumpType     `json:"type"`
+	Position dumpPosition `json:"position"`
+}
+
+type dumpClass struct {
+	Name             string         `json:"name"`
+	Parent           string         `json:"parent"`
+	ParentInterfaces []string       `json:"parent_interfaces"`
+	Interfaces       []string       `json:"interfaces"`
+	Traits           []string       `json:"traits"`
+	Methods          []dumpFunction `json:"methods"`
+	Properties       []dumpProperty `json:"properties"`
+	Constants        []dumpConstant `json:"constants"`
+	Position         dumpPosition   `json:"position"`
+}
+
+// dumpFunctionOverride means that function return type depends on the argument with ArgNum index:
+// it is either the same as the argument type ("arg") or the type of its element ("element").
+type dumpFunctionOverride struct {
+	Name     string `json:"name"`
+	Override string `json:"override"`
+	ArgNum   int    `json:"arg_num"`
+}
+
+func newDumpPosition(pos meta.ElementPosition) dumpPosition {
+	return dumpPosition{
+		Filename:  pos.Filename,
+		Line:      pos.Line,
+		EndLine:   pos.EndLine,
+		Character: pos.Character,
+		Length:    pos.Length,
+	}
+}
+
+func newDumpType(m *meta.TypesMap) dumpType {
+	res := dumpType{Raw: []string{}, Resolved: []string{}}
+
+	m.Iterate(func(typ string) {
+		res.Raw = append(res.Raw, meta.FormatType(typ))
+	})
+
+	for typ := range solver.ResolveTypes(m, make(map[string]struct{})) {
+		res.Resolved = append(res.Resolved, meta.FormatType(typ))
+	}
+	sort.Strings(res.Resolved)
+
+	return res
+}
+
+func newDumpFunction(name string, fn meta.FuncInfo) dumpFunction {
+	res := dumpFunction{
+		Name:       name,
+		Access:     fn.AccessLevel.String(),
+		Params:     []dumpParam{},
+		MinParams:  fn.MinParamsCnt,
+		ReturnType: newDumpType(fn.Typ),
+		ExitFlags:  fn.ExitFlags,
+		Position:   newDumpPosition(fn.Pos),
+	}
+
+	for _, p := range fn.Params {
+		res.Params = append(res.Params, dumpParam{Name: p.Name, IsRef: p.IsRef, Type: newDumpType(p.Typ)})
+	}
+
+	return res
+}
+
+func newDumpFunctions(m meta.FunctionsMap, include func(meta.ElementPosition) bool) []dumpFunction {
+	res := []dumpFunction{}
+	for _, name := range sortedNames(m) {
+		if include(m[name].Pos) {
+			res = append(res, newDumpFunction(name, m[name]))
+		}
+	}
+	return res
+}
+
+func newDumpConstants(m meta.ConstantsMap, include func(meta.ElementPosition) bool) []dumpConstant {
+	res := []dumpConstant{}
+	for _, name := range sortedNames(m) {
+		c := m[name]
+		if include(c.Pos) {
+			res = append(res, dumpConstant{
+				Name:     name,
+				Access:   c.AccessLevel.String(),
+				Type:     newDumpType(c.Typ),
+				Position: newDumpPosition(c.Pos),
+			})
+		}
+	}
+	return res
+}
+
+func newDumpClasses(m meta.ClassesMap, include func(meta.ElementPosition) bool) []dumpClass {
+	all := func(meta.ElementPosition) bool { return true }
+
+	res := []dumpClass{}
+	for _, name := range sortedNames(m) {
+		c := m[name]
+		if !include(c.Pos) {
+			continue
+		}
+
+		d := dumpClass{
+			Name:             name,
+			Parent:           c.Parent,
+			ParentInterfaces: append([]string{}, c.ParentInterfaces...),
+			Interfaces:       sortedNames(c.Interfaces),
+			Traits:           sortedNames(c.Traits),
+			Methods:          newDumpFunctions(c.Methods, all),
+			Properties:       []dumpProperty{},
+			Constants:        newDumpConstants(c.Constants, all),
+			Position:         newDumpPosition(c.Pos),
+		}
+
+		for _, propName := range sortedNames(c.Properties) {
+			p := c.Properties[propName]
+			d.Properties = append(d.Properties, dumpProperty{
+				Name:     strings.TrimPrefix(propName, "$"),
+				Static:   strings.HasPrefix(propName, "$"),
+				Access:   p.AccessLevel.String(),
+				Type:     newDumpType(p.Typ),
+				Position: newDumpPosition(p.Pos),
+			})
+		}
+
+		res = append(res, d)
+	}
+	return res
+}
+
+// sortedNames returns sorted keys of any map with string keys.
+func sortedNames(m interface{}) []string {
+	var res []string
+
+	switch m := m.(type) {
+	case meta.ClassesMap:
+		for k := range m {
+			res = append(res, k)
+		}
+	case meta.FunctionsMap:
+		for k := range m {
+			res = append(res, k)
+		}
+	case meta.ConstantsMap:
+		for k := range m {
+			res = append(res, k)
+		}
+	case meta.PropertiesMap:
+		for k := range m {
+			res = append(res, k)
+		}
+	case meta.FunctionsOverrideMap:
+		for k := range m {
+			res = append(res, k)
+		}
+	case map[string]struct{}:
+		for k := range m {
+			res = append(res, k)
+		}
+	default:
+		panic("unexpected map type")
+	}
+
+	sort.Strings(res)
+	if res == nil {
+		res = []string{}
+	}
+	return res
+}
+
+// newIndexDump converts current meta info into dump. Definitions from stubs are included only if withStubs is set.
+func newIndexDump(withStubs bool) *indexDump {
+	stubsPrefix := ""
+	if !withStubs {
+		if dir, err := filepath.Abs(linter.StubsDir); err == nil {
+			stubsPrefix = dir + string(filepath.Separator)
+		}
+	}
+
+	include := func(pos meta.ElementPosition) bool {
+		return stubsPrefix == "" || !strings.HasPrefix(pos.Filename, stubsPrefix)
+	}
+
+	meta.Info.Lock()
+	defer meta.Info.Unlock()
+
+	d := &indexDump{
+		Version:           indexDumpVersion,
+		Classes:           newDumpClasses(meta.Info.AllClassesNonLocked(), include),
+		Traits:            newDumpClasses(meta.ClassesMap(meta.Info.AllTraitsNonLocked()), include),
+		Functions:         newDumpFunctions(meta.Info.AllFunctionsNonLocked(), include),
+		Constants:         newDumpConstants(meta.Info.AllConstantsNonLocked(), include),
+		FunctionOverrides: []dumpFunctionOverride{},
+	}
+
+	overrides := meta.Info.AllFunctionsOverridesNonLocked()
+	for _, name := range sortedNames(overrides) {
+		o := overrides[name]
+
+		typ := "arg"
+		if o.OverrideType == meta.OverrideElementType {
+			typ = "element"
+		}
+
+		d.FunctionOverrides = append(d.FunctionOverrides, dumpFunctionOverride{Name: name, Override: typ, ArgNum: o.ArgNum})
+	}
+
+	return d
+}
+
+func writeIndexDump(w io.Writer, withStubs bool) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(newIndexDump(withStubs))
+}
+
+// dumpIndexMain indexes files specified in command line and writes meta info as JSON
+// to -output file or to stdout.
+func dumpIndexMain() {
+	linter.InitStubs()
+
+	log.Printf("Indexing %+v", flag.Args())
+	linter.ParseFilenames(linter.ReadFilenames(flag.Args(), nil))
+	meta.SetIndexingComplete(true)
+
+	var w io.Writer = os.Stdout
+	if output != "" {
+		w = outputFp
+	}
+
+	if err := writeIndexDump(w, dumpStubs); err != nil {
+		log.Fatalf("Could not write index: %s", err.Error())
+	}
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/VKCOM/noverify/src/linter"
+)
+
+// applyFixes applies automatic fixes of the reports to the files in place
+// and returns reports that were not fixed.
+//
+// Fixes that overlap with other fixes in the same file are not applied,
+// run linter again to apply them.
+func applyFixes(reports []*linter.Report) (unfixed []*linter.Report) {
+	byFile := make(map[string][]*linter.Report)
+	var filenames []string
+
+	for _, r := range reports {
+		if r.Fix() == nil {
+			unfixed = append(unfixed, r)
+			continue
+		}
+
+		filename := r.GetFilename()
+		if _, ok := byFile[filename]; !ok {
+			filenames = append(filenames, filename)
+		}
+		byFile[filename] = append(byFile[filename], r)
+	}
+
+	sort.Strings(filenames)
+
+	var fixedReports, fixedFiles int
+
+	for _, filename := range filenames {
+		list := byFile[filename]
+
+		st, err := os.Stat(filename)
+		if err != nil {
+			log.Fatalf("Could not stat %s: %s", filename, err.Error())
+		}
+
+		contents, err := ioutil.ReadFile(filename)
+		if err != nil {
+			log.Fatalf("Could not read %s: %s", filename, err.Error())
+		}
+
+		fixes := make([]*linter.Fix, 0, len(list))
+		for _, r := range list {
+			fixes = append(fixes, r.Fix())
+		}
+
+		newContents, applied := linter.ApplyFixes(contents, fixes)
+		if len(applied) == 0 {
+			unfixed = append(unfixed, list...)
+			continue
+		}
+
+		appliedSet := make(map[*linter.Fix]bool, len(applied))
+		for _, f := range applied {
+			appliedSet[f] = true
+		}
+
+		for _, r := range list {
+			if !appliedSet[r.Fix()] {
+				unfixed = append(unfixed, r)
+			}
+		}
+
+		if err := ioutil.WriteFile(filename, newContents, st.Mode()); err != nil {
+			log.Fatalf("Could not write %s: %s", filename, err.Error())
+		}
+
+		fixedReports += len(applied)
+		fixedFiles++
+	}
+
+	log.Printf("Fixed %d reports in %d files", fixedReports, fixedFiles)
+
+	return unfixed
+}
@@ -0,0 +1,408 @@
+package cmd
+
+import (
+	"bytes"
+	"html"
+	"html/template"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/VKCOM/noverify/src/linter"
+)
+
+// htmlSite is a static site with an index page for every directory and a page for every file with reports.
+// Pages are self-contained and use only relative links, so the site can be browsed offline.
+type htmlSite struct {
+	dirs  map[string]*htmlSiteDir
+	files map[string]*htmlSiteFile
+}
+
+type htmlSiteDir struct {
+	Path     string
+	Count    int
+	Critical int
+
+	subdirs map[string]bool
+	files   map[string]bool
+}
+
+type htmlSiteFile struct {
+	Path     string
+	Count    int
+	Critical int
+
+	reports  []*linter.Report
+	contents []byte
+}
+
+// htmlEntry is a row in a directory index.
+type htmlEntry struct {
+	Name     string
+	Link     string
+	IsDir    bool
+	Count    int
+	Critical int
+}
+
+type htmlReport struct {
+	Line     int
+	Severity string
+	Critical bool
+	Check    string
+	Message  string
+}
+
+type htmlLine struct {
+	Num     int
+	Class   string
+	Code    template.HTML
+	Reports []htmlReport
+}
+
+// htmlSitePath converts report filename into a relative path inside the site.
+func htmlSitePath(filename string) string {
+	return strings.TrimPrefix(path.Clean("/"+baselineFilename(filename)), "/")
+}
+
+func newHTMLSite(reports []*linter.Report) *htmlSite {
+	s := &htmlSite{
+		dirs:  make(map[string]*htmlSiteDir),
+		files: make(map[string]*htmlSiteFile),
+	}
+
+	for _, r := range reports {
+		p := htmlSitePath(r.GetFilename())
+
+		f, ok := s.files[p]
+		if !ok {
+			f = &htmlSiteFile{Path: p}
+			s.files[p] = f
+		}
+		f.reports = append(f.reports, r)
+		if f.contents == nil {
+			f.contents = r.FileContents()
+		}
+		f.Count++
+		if r.IsCritical() {
+			f.Critical++
+		}
+
+		child, isFile := p, true
+		for {
+			dir := path.Dir(child)
+			if dir == "." {
+				dir = ""
+			}
+
+			d := s.dir(dir)
+			d.Count++
+			if r.IsCritical() {
+				d.Critical++
+			}
+			if isFile {
+				d.files[child] = true
+			} else {
+				d.subdirs[child] = true
+			}
+
+			if dir == "" {
+				break
+			}
+			child, isFile = dir, false
+		}
+	}
+
+	return s
+}
+
+func (s *htmlSite) dir(p string) *htmlSiteDir {
+	d, ok := s.dirs[p]
+	if !ok {
+		d = &htmlSiteDir{Path: p, subdirs: make(map[string]bool), files: make(map[string]bool)}
+		s.dirs[p] = d
+	}
+	return d
+}
+
+// writeHTMLSite writes static HTML report into the specified directory.
+func writeHTMLSite(dir string, reports []*linter.Report) error {
+	s := newHTMLSite(reports)
+
+	// root index must exist even if there are no reports at all
+	s.dir("")
+
+	for _, d := range s.dirs {
+		if err := s.writeDir(dir, d); err != nil {
+			return err
+		}
+	}
+
+	for _, f := range s.files {
+		if err := s.writeFile(dir, f); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *htmlSite) writeDir(root string, d *htmlSiteDir) error {
+	var entries []htmlEntry
+
+	for p := range d.subdirs {
+		sub := s.dirs[p]
+		entries = append(entries, htmlEntry{
+			Name:     path.Base(p) + "/",
+			Link:     path.Base(p) + "/index.html",
+			IsDir:    true,
+			Count:    sub.Count,
+			Critical: sub.Critical,
+		})
+	}
+
+	for p := range d.files {
+		f := s.files[p]
+		entries = append(entries, htmlEntry{
+			Name:     path.Base(p),
+			Link:     path.Base(p) + ".html",
+			Count:    f.Count,
+			Critical: f.Critical,
+		})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].IsDir != entries[j].IsDir {
+			return entries[i].IsDir
+		}
+		return entries[i].Name < entries[j].Name
+	})
+
+	title := d.Path
+	if title == "" {
+		title = "."
+	}
+
+	return writeHTMLPage(filepath.Join(root, filepath.FromSlash(d.Path), "index.html"), htmlDirTemplate, map[string]interface{}{
+		"Title":   title,
+		"Dir":     d,
+		"IsRoot":  d.Path == "",
+		"Entries": entries,
+	})
+}
+
+func (s *htmlSite) writeFile(root string, f *htmlSiteFile) error {
+	sort.SliceStable(f.reports, func(i, j int) bool {
+		a, b := f.reports[i], f.reports[j]
+		if a.StartLine() != b.StartLine() {
+			return a.StartLine() < b.StartLine()
+		}
+		return a.StartChar() < b.StartChar()
+	})
+
+	var summary []htmlReport
+	for _, r := range f.reports {
+		summary = append(summary, newHTMLReport(r))
+	}
+
+	return writeHTMLPage(filepath.Join(root, filepath.FromSlash(f.Path)+".html"), htmlFileTemplate, map[string]interface{}{
+		"Title":   f.Path,
+		"File":    f,
+		"Reports": summary,
+		"Lines":   htmlSourceLines(f.contents, f.reports),
+	})
+}
+
+func newHTMLReport(r *linter.Report) htmlReport {
+	return htmlReport{
+		Line:     r.StartLine(),
+		Severity: linter.SeverityName(r.Level()),
+		Critical: r.IsCritical(),
+		Check:    r.CheckName(),
+		Message:  r.Message(),
+	}
+}
+
+const (
+	htmlMarkNone = iota
+	htmlMarkMaybe
+	htmlMarkCritical
+)
+
+// htmlSourceLines splits file contents into lines and highlights reported ranges.
+// Reports are attached to the lines they start at.
+func htmlSourceLines(contents []byte, reports []*linter.Report) []htmlLine {
+	if contents == nil {
+		return nil
+	}
+
+	src := bytes.Split(contents, []byte("\n"))
+	lines := make([]htmlLine, len(src))
+	marks := make([][]int, len(src))
+
+	for i, ln := range src {
+		src[i] = bytes.TrimSuffix(ln, []byte("\r"))
+		lines[i].Num = i + 1
+		marks[i] = make([]int, len(src[i]))
+	}
+
+	for _, r := range reports {
+		mark := htmlMarkMaybe
+		if r.IsCritical() {
+			mark = htmlMarkCritical
+		}
+
+		startLine, endLine := r.StartLine(), r.EndLine()
+		if endLine < startLine {
+			endLine = startLine
+		}
+		if startLine < 1 || startLine > len(src) {
+			continue
+		}
+		if endLine > len(src) {
+			endLine = len(src)
+		}
+
+		lines[startLine-1].Reports = append(lines[startLine-1].Reports, newHTMLReport(r))
+
+		for ln := startLine; ln <= endLine; ln++ {
+			m := marks[ln-1]
+
+			from, to := 0, len(m)
+			if ln == startLine {
+				from = r.StartChar()
+			}
+			if ln == r.EndLine() && r.EndChar() > from {
+				to = r.EndChar()
+			}
+			if from < 0 {
+				from = 0
+			}
+			if to > len(m) {
+				to = len(m)
+			}
+
+			for i := from; i < to; i++ {
+				if m[i] < mark {
+					m[i] = mark
+				}
+			}
+
+			if lines[ln-1].Class == "" || mark == htmlMarkCritical {
+				lines[ln-1].Class = htmlMarkClass(mark)
+			}
+		}
+	}
+
+	for i, ln := range src {
+		lines[i].Code = htmlHighlight(ln, marks[i])
+	}
+
+	return lines
+}
+
+func htmlMarkClass(mark int) string {
+	switch mark {
+	case htmlMarkCritical:
+		return "critical"
+	case htmlMarkMaybe:
+		return "maybe"
+	}
+	return ""
+}
+
+// htmlHighlight escapes source line and wraps marked byte runs into spans.
+func htmlHighlight(ln []byte, marks []int) template.HTML {
+	var b strings.Builder
+
+	for i := 0; i < len(ln); {
+		j := i
+		for j < len(ln) && marks[j] == marks[i] {
+			j++
+		}
+
+		text := html.EscapeString(string(ln[i:j]))
+		if marks[i] == htmlMarkNone {
+			b.WriteString(text)
+		} else {
+			b.WriteString(`<span class="hl-` + htmlMarkClass(marks[i]) + `">` + text + `</span>`)
+		}
+
+		i = j
+	}
+
+	return template.HTML(b.String())
+}
+
+func writeHTMLPage(filename string, tpl *template.Template, data interface{}) error {
+	if err := os.MkdirAll(filepath.Dir(filename), 0777); err != nil {
+		return err
+	}
+
+	fp, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	if err := tpl.Execute(fp, data); err != nil {
+		fp.Close()
+		return err
+	}
+
+	return fp.Close()
+}
+
+const htmlHead = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>NoVerify: {{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 20px; }
+table.index { border-collapse: collapse; }
+table.index td, table.index th { padding: 2px 12px; text-align: left; }
+table.index td.num { text-align: right; }
+.critical-count { color: #c00; }
+table.source { border-collapse: collapse; font-family: monospace; }
+table.source td { padding: 0 8px; vertical-align: top; white-space: pre; tab-size: 4; }
+td.ln { color: #999; text-align: right; user-select: none; }
+td.ln a { color: inherit; text-decoration: none; }
+tr.critical td.ln { background: #fdd; }
+tr.maybe td.ln { background: #ffd; }
+.hl-critical { background: #fbb; text-decoration: underline wavy #c00; }
+.hl-maybe { background: #ffb; text-decoration: underline wavy #990; }
+div.report { font-family: sans-serif; white-space: normal; margin: 2px 0; padding: 2px 6px; border-left: 3px solid #990; background: #ffe; }
+div.report.critical { border-left-color: #c00; background: #fee; }
+</style>
+</head>
+<body>
+`
+
+const htmlFoot = `</body>
+</html>
+`
+
+var htmlDirTemplate = template.Must(template.New("dir").Parse(htmlHead + `
+<h1>{{.Title}}</h1>
+{{if not .IsRoot}}<p><a href="../index.html">Up</a></p>{{end}}
+<p>{{.Dir.Count}} reports, <span class="critical-count">{{.Dir.Critical}} critical</span></p>
+<table class="index">
+<tr><th>Name</th><th>Reports</th><th>Critical</th></tr>
+{{range .Entries}}<tr><td><a href="{{.Link}}">{{.Name}}</a></td><td class="num">{{.Count}}</td><td class="num critical-count">{{.Critical}}</td></tr>
+{{end}}</table>
+` + htmlFoot))
+
+var htmlFileTemplate = template.Must(template.New("file").Parse(htmlHead + `
+<h1>{{.Title}}</h1>
+<p><a href="index.html">Up</a></p>
+<p>{{.File.Count}} reports, <span class="critical-count">{{.File.Critical}} critical</span></p>
+<ul>
+{{range .Reports}}<li><a href="#L{{.Line}}">line {{.Line}}</a>: {{.Severity}} {{.Check}}: {{.Message}}</li>
+{{end}}</ul>
+{{if .Lines}}<table class="source">
+{{range .Lines}}<tr id="L{{.Num}}" class="{{.Class}}"><td class="ln"><a href="#L{{.Num}}">{{.Num}}</a></td><td>{{.Code}}{{range .Reports}}<div class="report{{if .Critical}} critical{{end}}"><b>{{.Severity}}</b> {{.Check}}: {{.Message}}</div>{{end}}</td></tr>
+{{end}}</table>
+{{else}}<p>Source code is not available.</p>
+{{end}}` + htmlFoot))
@@ -1,13 +1,16 @@
 package cmd
 
 import (
+	"crypto/md5"
 	"flag"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
 	_ "net/http/pprof" // it is ok for actually main package
 	"os"
+	"path/filepath"
 	"regexp"
 	"runtime"
 	"strings"
@@ -41,8 +44,16 @@ var (
 	gitPushArg          string
 	gitAuthorsWhitelist string
 	gitWorkTree         string
+	gitStaged           bool
 	gitSkipFetch        bool
 	gitFullDiff         bool
+	gitRemote           string
+	gitBaseBranch       string
+	gitBaseRef          string
+	gitDeepen           int
+	gitGroupByAuthor    bool
+	gitAuthorFilter     string
+	gitAuthorFilterSet  map[string]bool
 
 	reportsExclude          string
 	reportsExcludeRegex     *regexp.Regexp
@@ -54,11 +65,52 @@ var (
 
 	fullAnalysisFiles string
 
-	output string
+	baselineCreate  string
+	baselinePath    string
+	reportsBaseline *baseline
+
+	output       string
+	outputFormat string
+	htmlDir      string
+
+	configPath     string
+	configFilename string
+	configHash     string
+
+	checkSeverity string
+
+	fixMode bool
+
+	daemonMode bool
+	daemonAddr string
+
+	watchMode     bool
+	watchInterval time.Duration
+
+	statsMode  bool
+	statsTop   int
+	statsDepth int
+
+	dumpStubs bool
+
+	trendCommits int
+	trendFormat  string
+
+	cacheGC bool
+
+	listChecks   bool
+	explainCheck string
 
 	version bool
 )
 
+// commands are modes that are selected by the first command line argument, e.g. "noverify dump-index ./src".
+var commands = map[string]func(){
+	"dump-index":     dumpIndexMain,
+	"stubs-snapshot": stubsSnapshotMain,
+	"trend":          trendMain,
+}
+
 func init() {
 	flag.StringVar(&pprofHost, "pprof", "", "HTTP pprof endpoint (e.g. localhost:8080)")
 
@@ -70,8 +122,15 @@ func init() {
 	flag.StringVar(&gitPushArg, "git-push-arg", "", "In {pre,post}-receive hooks a whole line from stdin can be passed")
 	flag.StringVar(&gitAuthorsWhitelist, "git-author-whitelist", "", "Whitelist (comma-separated) for commit authors, if needed")
 	flag.StringVar(&gitWorkTree, "git-work-tree", "", "Work tree. If specified, local changes will also be examined.")
-	flag.BoolVar(&gitSkipFetch, "git-skip-fetch", false, "Do not fetch ORIGIN_MASTER (use this option if you already fetch to ORIGIN_MASTER before that)")
+	flag.BoolVar(&gitStaged, "git-staged", false, "Analyze only changes that are staged for commit (e.g. in pre-commit hook), comparing index with -git-commit-from (HEAD by default)")
+	flag.BoolVar(&gitSkipFetch, "git-skip-fetch", false, "Do not fetch -git-base-ref (use this option if you already fetch to -git-base-ref before that)")
 	flag.BoolVar(&gitFullDiff, "git-full-diff", false, "Compute full diff: analyze all files, not just changed ones")
+	flag.StringVar(&gitRemote, "git-remote", "origin", "Remote to fetch -git-base-branch from")
+	flag.StringVar(&gitBaseBranch, "git-base-branch", "master", "Base branch (e.g. main or develop), changes merged from it are not analyzed")
+	flag.StringVar(&gitBaseRef, "git-base-ref", "ORIGIN_MASTER", "Local ref that -git-base-branch is fetched to")
+	flag.BoolVar(&gitGroupByAuthor, "git-group-by-author", false, "Group reports by author of the commit that changed reported line")
+	flag.StringVar(&gitAuthorFilter, "git-author-filter", "", "Comma-separated list of commit authors, only reports on lines changed by them are shown")
+	flag.IntVar(&gitDeepen, "git-deepen", 100, "Number of commits to fetch into shallow clone when merge base with -git-base-ref can not be found, 0 disables fetching")
 
 	flag.StringVar(&reportsExclude, "exclude", "", "Exclude regexp for filenames in reports list")
 	flag.StringVar(&reportsExcludeChecks, "exclude-checks", "", "Comma-separated list of check names to be excluded")
@@ -79,7 +138,12 @@ func init() {
 
 	flag.StringVar(&fullAnalysisFiles, "full-analysis-files", "", "Comma-separated list of files to do full analysis")
 
+	flag.StringVar(&baselineCreate, "baseline-create", "", "Write all current reports to a specified baseline file and exit")
+	flag.StringVar(&baselinePath, "baseline", "", "Do not show reports that are listed in a specified baseline file")
+
 	flag.StringVar(&output, "output", "", "Output reports to a specified file instead of stderr")
+	flag.StringVar(&outputFormat, "output-format", outputFormatText, "Reports output format: text, json, sarif, checkstyle or junit")
+	flag.StringVar(&htmlDir, "html-dir", "", "Also write reports as a static HTML site with highlighted source code into a specified directory")
 
 	flag.BoolVar(&linter.Debug, "debug", false, "Enable debug output")
 	flag.IntVar(&linter.MaxFileSize, "max-sum-filesize", 20*1024*1024, "max total file size to be parsed concurrently in bytes (limits max memory consumption)")
@@ -87,7 +151,31 @@ func init() {
 	flag.BoolVar(&linter.LangServer, "lang-server", false, "Run language server for VS Code")
 	flag.StringVar(&linter.DefaultEncoding, "encoding", "UTF-8", "Default encoding. Only UTF-8 and windows-1251 are supported")
 	flag.StringVar(&linter.StubsDir, "stubs-dir", "/path/to/phpstorm-stubs", "phpstorm-stubs directory")
+	flag.StringVar(&linter.StubsSnapshot, "stubs-snapshot", "", "File with meta info of -stubs-dir that is loaded instead of parsing stubs, it is rewritten when stubs change (see stubs-snapshot command)")
 	flag.StringVar(&linter.CacheDir, "cache-dir", "", "Directory for linter cache (greatly improves indexing speed)")
+	flag.BoolVar(&cacheGC, "cache-gc", false, "Compact -cache-dir, removing entries for contents that were not seen by the last run, and exit")
+
+	flag.BoolVar(&statsMode, "stats", false, "Print reports statistics by check, severity, directory and file instead of reports themselves (text or json output format)")
+	flag.IntVar(&statsTop, "stats-top", 10, "Number of rows in -stats tables, 0 means all")
+	flag.IntVar(&statsDepth, "stats-depth", 2, "Number of directory levels used to group reports in -stats")
+
+	flag.BoolVar(&daemonMode, "daemon", false, "Run as a daemon that keeps index in memory and serves analysis requests on -daemon-addr")
+	flag.StringVar(&daemonAddr, "daemon-addr", "", "Unix socket path or localhost TCP address of the daemon. Without -daemon, send analysis request to the daemon instead of indexing")
+
+	flag.BoolVar(&watchMode, "watch", false, "Watch analyzed files for changes and print current reports after every change (full analysis mode only)")
+	flag.DurationVar(&watchInterval, "watch-interval", time.Second, "How often to check files for changes in -watch mode")
+
+	flag.BoolVar(&fixMode, "fix", false, "Apply automatic fixes to analyzed files in place (full analysis mode only)")
+	flag.StringVar(&checkSeverity, "check-severity", "", "Comma-separated list of check severity overrides in form checkName:severity[:pathGlob], e.g. caseBreak:error,undefined:maybe:legacy/")
+	flag.StringVar(&configPath, "config", "", "Project config file (default is "+strings.Join(linter.ConfigFilenames, " or ")+" in current directory, if present)")
+
+	flag.BoolVar(&dumpStubs, "dump-stubs", false, "Include definitions from -stubs-dir into dump-index output")
+
+	flag.IntVar(&trendCommits, "commits", 10, "Number of first-parent commits analyzed by trend command")
+	flag.StringVar(&trendFormat, "trend-format", "csv", "Output format of trend command: csv or json")
+
+	flag.BoolVar(&listChecks, "list-checks", false, "Show all known checks with their default severity and exit")
+	flag.StringVar(&explainCheck, "explain", "", "Show description and examples of the specified check and exit")
 
 	flag.BoolVar(&version, "version", false, "Show version info and exit")
 }
@@ -97,6 +185,10 @@ func isExcluded(r *linter.Report) bool {
 		return true
 	}
 
+	if gitAuthorFilterSet != nil && !gitAuthorFilterSet[reportAuthor(r)] {
+		return true
+	}
+
 	if reportsExcludeRegex == nil {
 		return false
 	}
@@ -116,6 +208,16 @@ func canBeDisabled(filename string) bool {
 // Main is the actual main function to be run. It is separate from linter so that you can insert your own hooks
 // before running main().
 func Main() {
+	var command func()
+	var commandName string
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			command = cmd
+			commandName = os.Args[1]
+			os.Args = append(os.Args[:1], os.Args[2:]...)
+		}
+	}
+
 	flag.Parse()
 
 	if version {
@@ -123,12 +225,82 @@ func Main() {
 		return
 	}
 
+	if listChecks {
+		writeChecksList(os.Stdout)
+		return
+	}
+
+	if explainCheck != "" {
+		if err := writeCheckExplanation(os.Stdout, explainCheck); err != nil {
+			log.Fatalf("Could not explain check: %s", err.Error())
+		}
+		return
+	}
+
 	if pprofHost != "" {
 		go http.ListenAndServe(pprofHost, nil)
 	}
 
+	loadConfig()
+
+	if cacheGC {
+		start := time.Now()
+		kept, dropped, err := linter.CompactCache()
+		if err != nil {
+			log.Fatalf("Could not compact cache: %s", err.Error())
+		}
+		log.Printf("Compacted cache in %s: kept %d entries, removed %d", time.Since(start), kept, dropped)
+		return
+	}
+
 	compileRegexes()
 	buildCheckMappings()
+	buildAuthorFilter()
+
+	if err := checkOutputFormat(); err != nil {
+		log.Fatalf("Bad -output-format: %s", err.Error())
+	}
+	if statsMode && outputFormat != outputFormatText && outputFormat != "json" {
+		log.Fatalf("-stats only supports text and json output formats")
+	}
+
+	if fixMode && (gitRepo != "" || linter.LangServer) {
+		log.Fatalf("-fix can only be used in full analysis mode")
+	}
+	if baselineCreate != "" && (command != nil || gitRepo != "" || linter.LangServer || daemonMode) {
+		log.Fatalf("-baseline-create can only be used in full analysis mode")
+	}
+	if fixMode && linter.DefaultEncoding != "UTF-8" {
+		log.Fatalf("-fix can only be used with UTF-8 encoding")
+	}
+	if daemonMode && daemonAddr == "" {
+		log.Fatalf("-daemon requires -daemon-addr")
+	}
+	if daemonAddr != "" && !daemonMode && (linter.LangServer || gitFullDiff) {
+		log.Fatalf("-daemon-addr can not be used with -lang-server or -git-full-diff")
+	}
+	if watchMode && (gitRepo != "" || linter.LangServer || daemonMode || daemonAddr != "" || fixMode || baselineCreate != "") {
+		log.Fatalf("-watch can only be used in full analysis mode without -daemon, -fix and -baseline-create")
+	}
+	if fixMode && htmlDir != "" {
+		log.Fatalf("-html-dir can not be used with -fix")
+	}
+	if gitStaged && (gitRepo == "" || gitWorkTree != "" || gitFullDiff || gitPushArg != "" || gitCommitTo != "") {
+		log.Fatalf("-git-staged requires -git and can not be used with -git-work-tree, -git-full-diff, -git-push-arg and -git-commit-to")
+	}
+	if err := checkAuthorFlags(commandName); err != nil {
+		log.Fatalf("%s", err.Error())
+	}
+
+	linter.KeepReportsContents = htmlDir != ""
+
+	if baselinePath != "" {
+		var err error
+		reportsBaseline, err = loadBaseline(baselinePath)
+		if err != nil {
+			log.Fatalf("Could not load baseline: %s", err.Error())
+		}
+	}
 
 	lintdebug.Register(func(msg string) { linter.DebugMessage("%s", msg) })
 	go linter.MemoryLimiterThread()
@@ -148,27 +320,56 @@ func Main() {
 	}
 
 	log.Printf("Started")
-	linter.InitStubs()
 
-	if gitRepo != "" {
-		gitMain()
+	if command != nil {
+		command()
 		return
 	}
 
-	linter.AnalysisFiles = flag.Args()
+	if daemonMode {
+		daemonMain()
+		return
+	}
 
-	log.Printf("Indexing %+v", flag.Args())
-	linter.ParseFilenames(linter.ReadFilenames(flag.Args(), nil))
-	meta.SetIndexingComplete(true)
-	log.Printf("Linting")
+	if daemonAddr == "" {
+		linter.InitStubs()
+	}
+
+	if gitRepo != "" {
+		gitMain()
+		return
+	}
 
 	filenames := flag.Args()
 	if fullAnalysisFiles != "" {
 		filenames = strings.Split(fullAnalysisFiles, ",")
 	}
 
-	reports := linter.ParseFilenames(linter.ReadFilenames(filenames, reportsExcludeRegex))
+	if watchMode {
+		watchMain(flag.Args(), filenames)
+		return
+	}
+
+	var reports []*linter.Report
+	if daemonAddr != "" {
+		reports = daemonCall(&daemonRequest{Paths: absPaths(flag.Args()), Filenames: absPaths(filenames)}).Reports
+	} else {
+		reports = computeFullReports(flag.Args(), filenames, reportsExcludeRegex, func() {
+			linter.ParseFilenames(linter.ReadFilenames(flag.Args(), nil))
+		})
+	}
+
+	if baselineCreate != "" {
+		count, err := createBaseline(baselineCreate, reports)
+		if err != nil {
+			log.Fatalf("Could not create baseline: %s", err.Error())
+		}
+		log.Printf("Written %d reports to baseline %s", count, baselineCreate)
+		return
+	}
+
 	criticalReports := analyzeReports(reports)
+	reportStaleBaseline()
 
 	if criticalReports > 0 {
 		log.Printf("Found %d critical reports", criticalReports)
@@ -176,6 +377,133 @@ func Main() {
 	}
 }
 
+// computeFullReports indexes the project using index callback and then lints filenames.
+func computeFullReports(paths, filenames []string, exclude *regexp.Regexp, index func()) []*linter.Report {
+	linter.AnalysisFiles = paths
+
+	log.Printf("Indexing %+v", paths)
+	index()
+	meta.SetIndexingComplete(true)
+	log.Printf("Linting")
+
+	return linter.ParseFilenames(linter.ReadFilenames(filenames, exclude))
+}
+
+// loadConfig reads project config and uses its values for the flags that were not set explicitly.
+func loadConfig() {
+	filename := configPath
+	if filename == "" {
+		filename = linter.FindConfig(".")
+	}
+
+	if filename == "" {
+		if checkSeverity == "" {
+			return
+		}
+
+		wd, err := os.Getwd()
+		if err != nil {
+			log.Fatalf("Could not get working directory: %s", err.Error())
+		}
+		cfg := buildSeverityConfig(linter.NewConfig(wd))
+
+		// language server loads config from the workspace root and applies command line flags to it,
+		// the config built here only validates them
+		if linter.LangServer {
+			langsrv.ConfigOverrides = applyConfigFlags
+			return
+		}
+
+		linter.SetConfig(cfg)
+		return
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		log.Fatalf("Could not load config: %s", err.Error())
+	}
+	configHash = fmt.Sprintf("%x", md5.Sum(data))
+
+	cfg, err := linter.LoadConfig(filename)
+	if err != nil {
+		log.Fatalf("Could not load config: %s", err.Error())
+	}
+
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	if !explicit["stubs-dir"] && cfg.StubsDir != "" {
+		linter.StubsDir = cfg.StubsDir
+	}
+	if !explicit["stubs-snapshot"] && cfg.StubsSnapshot != "" {
+		linter.StubsSnapshot = cfg.StubsSnapshot
+	}
+	if !explicit["cache-dir"] && cfg.CacheDir != "" {
+		linter.CacheDir = cfg.CacheDir
+	}
+	if !explicit["allow-disable"] && cfg.AllowDisable != "" {
+		allowDisable = cfg.AllowDisable
+	}
+	if !explicit["full-analysis-files"] && len(cfg.FullAnalysisFiles) != 0 {
+		fullAnalysisFiles = strings.Join(cfg.FullAnalysisFiles, ",")
+	}
+
+	linter.SetConfig(buildSeverityConfig(cfg))
+	log.Printf("Loaded config %s", filename)
+
+	configFilename, err = filepath.Abs(filename)
+	if err != nil {
+		log.Fatalf("Could not get config path: %s", err.Error())
+	}
+}
+
+// buildSeverityConfig applies command line flags to the config and compiles it.
+func buildSeverityConfig(cfg *linter.Config) *linter.Config {
+	if err := applyConfigFlags(cfg); err != nil {
+		log.Fatalf("Bad config: %s", err.Error())
+	}
+	return cfg
+}
+
+// applyConfigFlags replaces config exclusions with the ones from command line, if they are specified,
+// adds -check-severity overrides to the config and compiles it.
+func applyConfigFlags(cfg *linter.Config) error {
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	// exclusion flags replace config values instead of being merged with them
+	if explicit["exclude"] {
+		cfg.Exclude = nil
+	}
+	if explicit["exclude-checks"] {
+		cfg.ExcludeChecks = nil
+	}
+
+	for _, rule := range strings.Split(checkSeverity, ",") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+
+		parts := strings.SplitN(rule, ":", 3)
+		if len(parts) < 2 {
+			return fmt.Errorf("bad -check-severity rule '%s': expected checkName:severity[:pathGlob]", rule)
+		}
+
+		if _, ok := linter.GetDeclaredCheck(parts[0]); !ok {
+			return fmt.Errorf("unknown check %s in -check-severity, use -list-checks to see all checks", parts[0])
+		}
+
+		var pathGlob string
+		if len(parts) == 3 {
+			pathGlob = parts[2]
+		}
+		cfg.AddSeverity(parts[0], parts[1], pathGlob)
+	}
+
+	return cfg.Compile()
+}
+
 func compileRegexes() {
 	var err error
 
@@ -198,7 +526,14 @@ func buildCheckMappings() {
 	reportsExcludeChecksSet = make(map[string]bool)
 	names := strings.Split(reportsExcludeChecks, ",")
 	for _, name := range names {
-		reportsExcludeChecksSet[strings.TrimSpace(name)] = true
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if _, ok := linter.GetDeclaredCheck(name); !ok {
+			log.Fatalf("Unknown check %s in -exclude-checks, use -list-checks to see all checks", name)
+		}
+		reportsExcludeChecksSet[name] = true
 	}
 }
 
@@ -247,28 +582,75 @@ func gitRepoComputeReportsFromCommits(logArgs, diffArgs []string) (oldReports, r
 		reports = linter.ParseFilenames(linter.ReadFilesFromGit(gitRepo, gitCommitTo, reportsExcludeRegex))
 		log.Printf("Parsed new commit in %s (%d reports)", time.Since(start), len(reports))
 	} else {
-		start = time.Now()
-		linter.ParseFilenames(linter.ReadFilesFromGit(gitRepo, gitCommitTo, nil))
-		log.Printf("Indexing complete in %s", time.Since(start))
+		oldReports, reports = gitComputeReports(&gitReportsRequest{
+			Repo:        gitRepo,
+			IndexCommit: gitCommitTo,
+			OldCommit:   gitCommitFrom,
+			NewCommit:   gitCommitTo,
+			Changes:     changes,
+		})
+	}
 
-		meta.SetIndexingComplete(true)
+	return oldReports, reports, changes, changeLog, true
+}
 
-		start = time.Now()
-		oldReports = linter.ParseFilenames(linter.ReadOldFilesFromGit(gitRepo, gitCommitFrom, changes))
-		log.Printf("Parsed old files versions for %s", time.Since(start))
+// gitReportsRequest describes how to get reports for old and new versions of changed files.
+// New versions are read from WorkTree if it is specified, from the index if Staged is set and from NewCommit otherwise.
+type gitReportsRequest struct {
+	Repo        string       `json:"repo"`
+	IndexCommit string       `json:"index_commit"`
+	OldCommit   string       `json:"old_commit"`
+	NewCommit   string       `json:"new_commit"`
+	WorkTree    string       `json:"work_tree"`
+	Staged      bool         `json:"staged"`
+	Changes     []git.Change `json:"changes"`
+}
 
-		start = time.Now()
-		meta.SetIndexingComplete(false)
-		linter.ParseFilenames(linter.ReadFilesFromGitWithChanges(gitRepo, gitCommitTo, changes))
-		meta.SetIndexingComplete(true)
-		log.Printf("Indexed files versions for %s", time.Since(start))
+func gitComputeReports(req *gitReportsRequest) (oldReports, reports []*linter.Report) {
+	if daemonAddr != "" {
+		resp := daemonCall(&daemonRequest{Git: req})
+		return resp.OldReports, resp.Reports
+	}
 
-		start = time.Now()
-		reports = linter.ParseFilenames(linter.ReadFilesFromGitWithChanges(gitRepo, gitCommitTo, changes))
-		log.Printf("Parsed new file versions in %s", time.Since(start))
+	return computeGitReports(req, func() {
+		linter.ParseFilenames(linter.ReadFilesFromGit(req.Repo, req.IndexCommit, nil))
+	})
+}
+
+// computeGitReports indexes the project using index callback, lints old versions of changed files
+// and then indexes and lints their new versions.
+func computeGitReports(req *gitReportsRequest, index func()) (oldReports, reports []*linter.Report) {
+	newFiles := func() linter.ReadCallback {
+		if req.WorkTree != "" {
+			return linter.ReadChangesFromWorkTree(req.WorkTree, req.Changes)
+		}
+		if req.Staged {
+			return linter.ReadChangesFromIndex(req.Repo, req.Changes)
+		}
+		return linter.ReadFilesFromGitWithChanges(req.Repo, req.NewCommit, req.Changes)
 	}
 
-	return oldReports, reports, changes, changeLog, true
+	start := time.Now()
+	index()
+	log.Printf("Indexing complete in %s", time.Since(start))
+
+	meta.SetIndexingComplete(true)
+
+	start = time.Now()
+	oldReports = linter.ParseFilenames(linter.ReadOldFilesFromGit(req.Repo, req.OldCommit, req.Changes))
+	log.Printf("Parsed old files versions for %s", time.Since(start))
+
+	start = time.Now()
+	meta.SetIndexingComplete(false)
+	linter.ParseFilenames(newFiles())
+	meta.SetIndexingComplete(true)
+	log.Printf("Indexed new files versions for %s", time.Since(start))
+
+	start = time.Now()
+	reports = linter.ParseFilenames(newFiles())
+	log.Printf("Parsed new file versions in %s", time.Since(start))
+
+	return oldReports, reports
 }
 
 func gitRepoComputeReportsFromLocalChanges() (oldReports, reports []*linter.Report, changes []git.Change, ok bool) {
@@ -288,25 +670,45 @@ func gitRepoComputeReportsFromLocalChanges() (oldReports, reports []*linter.Repo
 
 	log.Printf("You have changes in your work tree, showing diff between %s and work tree", gitCommitFrom)
 
-	start := time.Now()
-	linter.ParseFilenames(linter.ReadFilesFromGit(gitRepo, gitCommitFrom, nil))
-	log.Printf("Indexing complete in %s", time.Since(start))
+	oldReports, reports = gitComputeReports(&gitReportsRequest{
+		Repo:        gitRepo,
+		IndexCommit: gitCommitFrom,
+		OldCommit:   gitCommitFrom,
+		WorkTree:    gitWorkTree,
+		Changes:     changes,
+	})
 
-	meta.SetIndexingComplete(true)
+	return oldReports, reports, changes, true
+}
 
-	start = time.Now()
-	oldReports = linter.ParseFilenames(linter.ReadOldFilesFromGit(gitRepo, gitCommitFrom, changes))
-	log.Printf("Parsed old files versions for %s", time.Since(start))
+// gitRepoComputeReportsFromIndex computes reports for changes that are staged for commit.
+// Unstaged changes in the work tree are ignored.
+func gitRepoComputeReportsFromIndex() (oldReports, reports []*linter.Report, changes []git.Change, ok bool) {
+	if gitCommitFrom == "" {
+		gitCommitFrom = "HEAD"
+	}
 
-	start = time.Now()
-	meta.SetIndexingComplete(false)
-	linter.ParseFilenames(linter.ReadChangesFromWorkTree(gitWorkTree, changes))
-	meta.SetIndexingComplete(true)
-	log.Printf("Indexed new files versions for %s", time.Since(start))
+	if _, err := git.RevParse(gitRepo, gitCommitFrom); err != nil {
+		log.Fatalf("Could not find commit %s: %s", gitCommitFrom, err.Error())
+	}
 
-	start = time.Now()
-	reports = linter.ParseFilenames(linter.ReadChangesFromWorkTree(gitWorkTree, changes))
-	log.Printf("Parsed new file versions in %s", time.Since(start))
+	changes, err := git.DiffStaged(gitRepo, gitCommitFrom)
+	if err != nil {
+		log.Fatalf("Could not compute git diff: %s", err.Error())
+	}
+
+	if len(changes) == 0 {
+		log.Printf("No changes are staged for commit")
+		return nil, nil, nil, false
+	}
+
+	oldReports, reports = gitComputeReports(&gitReportsRequest{
+		Repo:        gitRepo,
+		IndexCommit: gitCommitFrom,
+		OldCommit:   gitCommitFrom,
+		Staged:      true,
+		Changes:     changes,
+	})
 
 	return oldReports, reports, changes, true
 }
@@ -320,15 +722,24 @@ func gitMain() {
 		ok                  bool
 	)
 
-	// prepareGitArgs also populates global variables like fromCommit
-	logArgs, diffArgs := prepareGitArgs()
-
-	oldReports, reports, changes, ok = gitRepoComputeReportsFromLocalChanges()
-	if !ok {
-		oldReports, reports, changes, changeLog, ok = gitRepoComputeReportsFromCommits(logArgs, diffArgs)
+	if gitStaged {
+		// staged changes are not committed yet, so diffArgs are left empty: there is nothing to blame
+		oldReports, reports, changes, ok = gitRepoComputeReportsFromIndex()
 		if !ok {
 			return
 		}
+	} else {
+		// prepareGitArgs also populates global variables like fromCommit
+		var logArgs []string
+		logArgs, diffArgs = prepareGitArgs()
+
+		oldReports, reports, changes, ok = gitRepoComputeReportsFromLocalChanges()
+		if !ok {
+			oldReports, reports, changes, changeLog, ok = gitRepoComputeReportsFromCommits(logArgs, diffArgs)
+			if !ok {
+				return
+			}
+		}
 	}
 
 	start := time.Now()
@@ -367,17 +778,67 @@ func analyzeGitAuthorsWhiteList(changeLog []git.Commit) (shouldRun bool) {
 }
 
 func analyzeReports(diff []*linter.Report) (criticalReports int) {
+	var filtered []*linter.Report
+
 	for _, r := range diff {
 		if isExcluded(r) {
 			continue
 		}
 
+		if reportsBaseline != nil && reportsBaseline.suppress(r) {
+			continue
+		}
+
+		if r.IsDisabledByUser() && canBeDisabled(r.GetFilename()) {
+			continue
+		}
+
+		filtered = append(filtered, r)
+	}
+
+	if fixMode {
+		filtered = applyFixes(filtered)
+	}
+
+	if htmlDir != "" {
+		if err := writeHTMLSite(htmlDir, filtered); err != nil {
+			log.Fatalf("Could not write HTML report: %s", err.Error())
+		}
+		log.Printf("Written HTML report to %s", htmlDir)
+	}
+
+	var authorCounts map[string]int
+	if gitGroupByAuthor {
+		groupReportsByAuthor(filtered)
+		authorCounts = countReportsByAuthor(filtered)
+	}
+
+	if statsMode {
+		for _, r := range filtered {
+			if r.IsCritical() {
+				criticalReports++
+			}
+		}
+
+		if err := writeStats(outputFp, filtered); err != nil {
+			log.Fatalf("Could not write stats: %s", err.Error())
+		}
+
+		return criticalReports
+	}
+
+	for i, r := range filtered {
+		if gitGroupByAuthor && outputFormat == outputFormatText {
+			if author := reportAuthor(r); i == 0 || author != reportAuthor(filtered[i-1]) {
+				fmt.Fprintf(outputFp, "=== %s: %d reports ===\n", author, authorCounts[author])
+			}
+		}
+
 		if r.IsDisabledByUser() {
-			filename := r.GetFilename()
-			if !canBeDisabled(filename) {
-				fmt.Fprintf(outputFp, "You are not allowed to disable linter for file '%s'\n", filename)
+			if outputFormat == outputFormatText {
+				fmt.Fprintf(outputFp, "You are not allowed to disable linter for file '%s'\n", r.GetFilename())
 			} else {
-				continue
+				log.Printf("You are not allowed to disable linter for file '%s'", r.GetFilename())
 			}
 		}
 
@@ -385,12 +846,37 @@ func analyzeReports(diff []*linter.Report) (criticalReports int) {
 			criticalReports++
 		}
 
-		fmt.Fprintf(outputFp, "%s\n", r)
+		if outputFormat == outputFormatText {
+			fmt.Fprintf(outputFp, "%s\n", r)
+		}
+	}
+
+	if outputFormat != outputFormatText {
+		if err := outputFormats[outputFormat](outputFp, filtered); err != nil {
+			log.Fatalf("Could not write reports: %s", err.Error())
+		}
 	}
 
 	return criticalReports
 }
 
+// reportStaleBaseline prints baseline entries that no longer match any reports,
+// so that they can be removed from the baseline file.
+func reportStaleBaseline() {
+	if reportsBaseline == nil {
+		return
+	}
+
+	stale := reportsBaseline.stale()
+	for _, e := range stale {
+		log.Printf("Stale baseline entry (%d unmatched): %s: %s at %s", e.Count, e.CheckName, e.Message, e.Filename)
+	}
+
+	if len(stale) > 0 {
+		log.Printf("Found %d stale baseline entries, consider recreating baseline %s", len(stale), baselinePath)
+	}
+}
+
 func prepareGitArgs() (logArgs, diffArgs []string) {
 	if gitPushArg != "" {
 		args := strings.Fields(gitPushArg)
@@ -400,32 +886,36 @@ func prepareGitArgs() (logArgs, diffArgs []string) {
 		gitCommitFrom, gitCommitTo, gitRef = args[0], args[1], args[2]
 	}
 
-	if gitCommitFrom == git.Zero {
-		gitCommitFrom = "master"
-	}
-
 	if !gitSkipFetch {
 		start := time.Now()
-		log.Printf("Fetching origin master to ORIGIN_MASTER")
-		if err := git.Fetch(gitRepo, "master", "ORIGIN_MASTER"); err != nil {
-			log.Fatalf("Could not fetch ORIGIN_MASTER: %v", err.Error())
+		log.Printf("Fetching %s %s to %s", gitRemote, gitBaseBranch, gitBaseRef)
+		if err := git.Fetch(gitRepo, gitRemote, gitBaseBranch, gitBaseRef); err != nil {
+			log.Fatalf("Could not fetch %s: %v", gitBaseRef, err.Error())
 		}
 		log.Printf("Fetched for %s", time.Since(start))
 	}
 
-	fromAndMaster, err := git.MergeBase(gitRepo, "ORIGIN_MASTER", gitCommitFrom)
-	if err != nil {
-		log.Fatalf("Could not compute merge base between ORIGIN_MASTER and %s", gitCommitFrom)
+	// new branch is pushed, so it is compared with the base branch
+	newBranch := gitCommitFrom == git.Zero
+	if newBranch {
+		gitCommitFrom = gitBaseRef
 	}
 
-	toAndMaster, err := git.MergeBase(gitRepo, "ORIGIN_MASTER", gitCommitTo)
-	if err != nil {
-		log.Fatalf("Could not compute merge base between ORIGIN_MASTER and %s", gitCommitTo)
-	}
+	fromAndBase, fromOk := gitMergeBase(gitCommitFrom)
+	toAndBase, toOk := gitMergeBase(gitCommitTo)
 
-	// check if master was merged in between the commits
-	if fromAndMaster != toAndMaster {
-		gitCommitFrom = toAndMaster
+	switch {
+	case newBranch && !toOk:
+		log.Printf("Could not compute merge base between %s and %s, comparing %s with its parent commit", gitBaseRef, gitCommitTo, gitCommitTo)
+		gitCommitFrom = gitCommitTo + "^"
+		if _, err := git.RevParse(gitRepo, gitCommitFrom); err != nil {
+			log.Fatalf("Could not find parent commit of %s, fetch more history or specify -git-commit-from", gitCommitTo)
+		}
+	case !fromOk || !toOk:
+		log.Printf("Could not compute merge base with %s, changes merged from it are analyzed too", gitBaseRef)
+	case fromAndBase != toAndBase:
+		// base branch was merged in between the commits
+		gitCommitFrom = toAndBase
 	}
 
 	logArgs = []string{gitCommitFrom + ".." + gitCommitTo}
@@ -433,3 +923,33 @@ func prepareGitArgs() (logArgs, diffArgs []string) {
 
 	return logArgs, diffArgs
 }
+
+// maxDeepenAttempts limits how many times shallow repository is deepened, doubling depth each time.
+const maxDeepenAttempts = 5
+
+// gitMergeBase computes merge base between -git-base-ref and the commit.
+// Shallow repository is deepened when its history is not enough to find merge base.
+func gitMergeBase(commit string) (res string, ok bool) {
+	if _, err := git.RevParse(gitRepo, gitBaseRef); err != nil {
+		log.Printf("Could not find %s: %v", gitBaseRef, err)
+		return "", false
+	}
+
+	for attempt := 0; ; attempt++ {
+		res, err := git.MergeBase(gitRepo, gitBaseRef, commit)
+		if err == nil {
+			return res, true
+		}
+
+		if gitSkipFetch || gitDeepen <= 0 || attempt >= maxDeepenAttempts || !git.IsShallow(gitRepo) {
+			return "", false
+		}
+
+		depth := gitDeepen << uint(attempt)
+		log.Printf("Could not compute merge base between %s and %s in shallow clone, fetching %d more commits", gitBaseRef, commit, depth)
+		if err := git.Deepen(gitRepo, gitRemote, depth); err != nil {
+			log.Printf("Could not deepen repository: %v", err)
+			return "", false
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/VKCOM/noverify/src/linter"
+)
+
+const outputFormatText = "text"
+
+// reportsWriter writes all reports that survived filtering in some machine-readable format.
+type reportsWriter func(w io.Writer, reports []*linter.Report) error
+
+// outputFormats are formats other than text that can be specified in -output-format.
+// Text format is handled separately because it is written as soon as every report is processed.
+var outputFormats = map[string]reportsWriter{
+	"json":       writeJSONReports,
+	"sarif":      writeSarifReports,
+	"checkstyle": writeCheckstyleReports,
+	"junit":      writeJUnitReports,
+}
+
+func checkOutputFormat() error {
+	if outputFormat == outputFormatText {
+		return nil
+	}
+
+	if _, ok := outputFormats[outputFormat]; !ok {
+		return fmt.Errorf("unknown output format '%s'", outputFormat)
+	}
+
+	return nil
+}
+
+// jsonReport is the stable schema for a single report in JSON output.
+// Lines are 1-based, columns are 0-based byte offsets in the respective lines.
+// Do not rename or remove fields here, add new ones instead.
+type jsonReport struct {
+	CheckName   string `json:"check_name"`
+	Level       int    `json:"level"`
+	Severity    string `json:"severity"`
+	Critical    bool   `json:"critical"`
+	Filename    string `json:"filename"`
+	StartLine   int    `json:"start_line"`
+	StartColumn int    `json:"start_column"`
+	EndLine     int    `json:"end_line"`
+	EndColumn   int    `json:"end_column"`
+	Message     string `json:"message"`
+	SourceLine  string `json:"source_line"`
+
+	// Commit fields are only set in git mode for lines changed by the analyzed commits.
+	// CommitDate is in RFC 3339 format.
+	Commit     string `json:"commit,omitempty"`
+	Author     string `json:"author,omitempty"`
+	CommitDate string `json:"commit_date,omitempty"`
+}
+
+type jsonOutput struct {
+	Reports []jsonReport `json:"reports"`
+}
+
+func newJSONReport(r *linter.Report) jsonReport {
+	res := jsonReport{
+		CheckName:   r.CheckName(),
+		Level:       r.Level(),
+		Severity:    linter.SeverityName(r.Level()),
+		Critical:    r.IsCritical(),
+		Filename:    r.GetFilename(),
+		StartLine:   r.StartLine(),
+		StartColumn: r.StartChar(),
+		EndLine:     r.EndLine(),
+		EndColumn:   r.EndChar(),
+		Message:     r.Message(),
+		SourceLine:  r.SourceLine(),
+	}
+
+	if c := r.Commit(); c != nil {
+		res.Commit = c.Hash
+		res.Author = c.Author
+		if !c.Date.IsZero() {
+			res.CommitDate = c.Date.Format(time.RFC3339)
+		}
+	}
+
+	return res
+}
+
+func writeJSONReports(w io.Writer, reports []*linter.Report) error {
+	out := jsonOutput{Reports: make([]jsonReport, 0, len(reports))}
+	for _, r := range reports {
+		out.Reports = append(out.Reports, newJSONReport(r))
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(&out)
+}
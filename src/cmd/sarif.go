@@ -0,0 +1,212 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/VKCOM/noverify/src/linter"
+)
+
+const (
+	sarifSchema  = "https://schemastore.azurewebsites.net/schemas/json/sarif-2.1.0-rtm.4.json"
+	sarifVersion = "2.1.0"
+)
+
+var sarifLevels = map[int]string{
+	linter.LevelError:       "error",
+	linter.LevelWarning:     "warning",
+	linter.LevelInformation: "note",
+	linter.LevelHint:        "note",
+	linter.LevelUnused:      "note",
+	linter.LevelDoNotReject: "warning",
+	linter.LevelSyntax:      "error",
+}
+
+func sarifLevel(level int) string {
+	if l, ok := sarifLevels[level]; ok {
+		return l
+	}
+	return "none"
+}
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool       sarifTool     `json:"tool"`
+	ColumnKind string        `json:"columnKind"`
+	Results    []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Version        string      `json:"version,omitempty"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string              `json:"id"`
+	ShortDescription     sarifMessage        `json:"shortDescription"`
+	DefaultConfiguration *sarifConfiguration `json:"defaultConfiguration,omitempty"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId,omitempty"`
+}
+
+// sarifRegion uses 1-based lines and columns as required by SARIF. Columns are counted in UTF-16 code units.
+type sarifRegion struct {
+	StartLine   int          `json:"startLine"`
+	StartColumn int          `json:"startColumn"`
+	EndLine     int          `json:"endLine"`
+	EndColumn   int          `json:"endColumn"`
+	Snippet     sarifMessage `json:"snippet"`
+}
+
+// newSarifArtifactLocation returns location for absolute filenames (full analysis mode)
+// or relative to the repository root (git mode).
+func newSarifArtifactLocation(filename string) sarifArtifactLocation {
+	if !filepath.IsAbs(filename) {
+		return sarifArtifactLocation{URI: filepath.ToSlash(filename), URIBaseID: "%SRCROOT%"}
+	}
+
+	uri := filepath.ToSlash(filename)
+	if !strings.HasPrefix(uri, "/") {
+		uri = "/" + uri // windows paths like C:/dir/file.php
+	}
+	return sarifArtifactLocation{URI: "file://" + uri}
+}
+
+func sarifRules(reports []*linter.Report) (rules []sarifRule, ruleIndex map[string]int) {
+	names := make(map[string]struct{})
+	for _, info := range linter.GetDeclaredChecks() {
+		names[info.Name] = struct{}{}
+	}
+	for _, r := range reports {
+		names[r.CheckName()] = struct{}{}
+	}
+
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	ruleIndex = make(map[string]int, len(sorted))
+	for _, name := range sorted {
+		rule := sarifRule{ID: name, ShortDescription: sarifMessage{Text: "Custom check " + name}}
+		if info, ok := linter.GetDeclaredCheck(name); ok {
+			rule.ShortDescription.Text = info.Comment
+			rule.DefaultConfiguration = &sarifConfiguration{Level: sarifLevel(info.Default)}
+		}
+		ruleIndex[name] = len(rules)
+		rules = append(rules, rule)
+	}
+
+	return rules, ruleIndex
+}
+
+// sarifColumn converts 0-based byte offset in the line to 1-based column in UTF-16 code units.
+// Bytes beyond the end of the line are counted as one unit each.
+func sarifColumn(line string, offset int) int {
+	if offset > len(line) {
+		return sarifColumn(line, len(line)) + offset - len(line)
+	}
+
+	column := 1
+	for _, ch := range line[:offset] {
+		column += utf16Len(ch)
+	}
+	return column
+}
+
+func utf16Len(ch rune) int {
+	if ch >= 0x10000 {
+		return 2 // surrogate pair
+	}
+	return 1
+}
+
+func writeSarifReports(w io.Writer, reports []*linter.Report) error {
+	rules, ruleIndex := sarifRules(reports)
+
+	results := make([]sarifResult, 0, len(reports))
+	for _, r := range reports {
+		results = append(results, sarifResult{
+			RuleID:    r.CheckName(),
+			RuleIndex: ruleIndex[r.CheckName()],
+			Level:     sarifLevel(r.Level()),
+			Message:   sarifMessage{Text: r.Message()},
+			Locations: []sarifLocation{{
+				PhysicalLocation: sarifPhysicalLocation{
+					ArtifactLocation: newSarifArtifactLocation(r.GetFilename()),
+					Region: sarifRegion{
+						StartLine:   r.StartLine(),
+						StartColumn: sarifColumn(r.SourceLine(), r.StartChar()),
+						EndLine:     r.EndLine(),
+						EndColumn:   sarifColumn(r.EndSourceLine(), r.EndChar()),
+						Snippet:     sarifMessage{Text: r.SourceLine()},
+					},
+				},
+			}},
+		})
+	}
+
+	out := sarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs: []sarifRun{{
+			Tool: sarifTool{
+				Driver: sarifDriver{
+					Name:           "NoVerify",
+					InformationURI: "https://github.com/VKCOM/noverify",
+					Version:        BuildCommit,
+					Rules:          rules,
+				},
+			},
+			ColumnKind: "utf16CodeUnits",
+			Results:    results,
+		}},
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(&out)
+}
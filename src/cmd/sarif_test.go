@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/VKCOM/noverify/src/linter"
+)
+
+func TestWriteSarifReportsColumns(t *testing.T) {
+	tests := []struct {
+		report   string
+		expected sarifRegion
+	}{
+		{
+			// multi-byte characters are counted in UTF-16 code units
+			report:   `{"start_ln": "$ц = array(1);", "start_char": 6, "start_line": 2, "end_line": 2, "end_char": 14}`,
+			expected: sarifRegion{StartLine: 2, StartColumn: 6, EndLine: 2, EndColumn: 14},
+		},
+		{
+			// end column is computed from the end line, file contents are not needed
+			report:   `{"start_ln": "$ц = array(", "start_char": 6, "start_line": 2, "end_ln": "\t'😀') + 1;", "end_line": 3, "end_char": 8}`,
+			expected: sarifRegion{StartLine: 2, StartColumn: 6, EndLine: 3, EndColumn: 7},
+		},
+	}
+
+	for _, tc := range tests {
+		var r linter.Report
+		if err := json.Unmarshal([]byte(tc.report), &r); err != nil {
+			t.Fatalf("Could not decode report %s: %v", tc.report, err)
+		}
+
+		var buf bytes.Buffer
+		if err := writeSarifReports(&buf, []*linter.Report{&r}); err != nil {
+			t.Fatalf("Could not write SARIF: %v", err)
+		}
+
+		var log sarifLog
+		if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+			t.Fatalf("Could not decode SARIF: %v", err)
+		}
+
+		region := log.Runs[0].Results[0].Locations[0].PhysicalLocation.Region
+		region.Snippet = sarifMessage{}
+		if region != tc.expected {
+			t.Errorf("%s: expected region %+v, got %+v", tc.report, tc.expected, region)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/VKCOM/noverify/src/linter"
+)
+
+// statsEntry is the number of reports in a single group, e.g. for a single check name.
+type statsEntry struct {
+	Name     string `json:"name"`
+	Count    int    `json:"count"`
+	Critical int    `json:"critical"`
+}
+
+// reportsStats is the stable schema of -stats output in JSON.
+// Every table is sorted by count in descending order and is limited by -stats-top,
+// while totals are computed over all reports.
+type reportsStats struct {
+	Total       int `json:"total"`
+	Critical    int `json:"critical"`
+	Files       int `json:"files"`
+	Checks      int `json:"checks"`
+	Directories int `json:"directories"`
+
+	ByCheck     []statsEntry `json:"by_check"`
+	BySeverity  []statsEntry `json:"by_severity"`
+	ByDirectory []statsEntry `json:"by_directory"`
+	ByFile      []statsEntry `json:"by_file"`
+}
+
+type statsCounter map[string]*statsEntry
+
+func (c statsCounter) add(name string, critical bool) {
+	e, ok := c[name]
+	if !ok {
+		e = &statsEntry{Name: name}
+		c[name] = e
+	}
+
+	e.Count++
+	if critical {
+		e.Critical++
+	}
+}
+
+// top returns at most n entries with the largest counts (all entries if n <= 0).
+// Entries with equal counts are sorted by name so that the output is stable.
+func (c statsCounter) top(n int) []statsEntry {
+	res := make([]statsEntry, 0, len(c))
+	for _, e := range c {
+		res = append(res, *e)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Count != res[j].Count {
+			return res[i].Count > res[j].Count
+		}
+		return res[i].Name < res[j].Name
+	})
+
+	if n > 0 && len(res) > n {
+		res = res[:n]
+	}
+
+	return res
+}
+
+// statsDirectory returns first depth directories of a filename, relative to working directory if possible.
+func statsDirectory(filename string, depth int) string {
+	dir := path.Dir(baselineFilename(filename))
+	if depth <= 0 || dir == "." || dir == "/" {
+		return dir
+	}
+
+	abs := strings.HasPrefix(dir, "/")
+	parts := strings.Split(strings.TrimPrefix(dir, "/"), "/")
+	if len(parts) > depth {
+		parts = parts[:depth]
+	}
+
+	dir = strings.Join(parts, "/")
+	if abs {
+		dir = "/" + dir
+	}
+
+	return dir
+}
+
+func computeStats(reports []*linter.Report, top, depth int) *reportsStats {
+	byCheck := make(statsCounter)
+	bySeverity := make(statsCounter)
+	byDirectory := make(statsCounter)
+	byFile := make(statsCounter)
+
+	s := &reportsStats{}
+
+	for _, r := range reports {
+		critical := r.IsCritical()
+
+		s.Total++
+		if critical {
+			s.Critical++
+		}
+
+		byCheck.add(r.CheckName(), critical)
+		bySeverity.add(linter.SeverityName(r.Level()), critical)
+		byDirectory.add(statsDirectory(r.GetFilename(), depth), critical)
+		byFile.add(baselineFilename(r.GetFilename()), critical)
+	}
+
+	s.Files = len(byFile)
+	s.Checks = len(byCheck)
+	s.Directories = len(byDirectory)
+
+	s.ByCheck = byCheck.top(top)
+	s.BySeverity = bySeverity.top(0)
+	s.ByDirectory = byDirectory.top(top)
+	s.ByFile = byFile.top(top)
+
+	return s
+}
+
+func writeStats(w io.Writer, reports []*linter.Report) error {
+	s := computeStats(reports, statsTop, statsDepth)
+
+	if outputFormat == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(s)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+
+	writeTable := func(title string, total int, entries []statsEntry) {
+		fmt.Fprintf(tw, "%s (top %d of %d)\n", title, len(entries), total)
+		fmt.Fprintf(tw, "count\tcritical\t \t\n")
+		for _, e := range entries {
+			fmt.Fprintf(tw, "%d\t%d\t \t%s\n", e.Count, e.Critical, e.Name)
+		}
+		fmt.Fprintf(tw, "\n")
+	}
+
+	writeTable("Checks", s.Checks, s.ByCheck)
+	writeTable("Severities", len(s.BySeverity), s.BySeverity)
+	writeTable("Directories", s.Directories, s.ByDirectory)
+	writeTable("Files", s.Files, s.ByFile)
+
+	fmt.Fprintf(tw, "Total: %d reports (%d critical) in %d files\n", s.Total, s.Critical, s.Files)
+
+	return tw.Flush()
+}
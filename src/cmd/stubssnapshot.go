@@ -0,0 +1,21 @@
+package cmd
+
+import (
+	"log"
+
+	"github.com/VKCOM/noverify/src/linter"
+)
+
+// stubsSnapshotMain parses -stubs-dir and writes its meta info to -stubs-snapshot file,
+// so that following runs with the same -stubs-snapshot do not parse stubs.
+func stubsSnapshotMain() {
+	if linter.StubsSnapshot == "" {
+		log.Fatalf("stubs-snapshot requires -stubs-snapshot")
+	}
+
+	if err := linter.WriteStubsSnapshot(linter.StubsSnapshot); err != nil {
+		log.Fatalf("Could not write stubs snapshot: %s", err.Error())
+	}
+
+	log.Printf("Written stubs snapshot to %s", linter.StubsSnapshot)
+}
@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/VKCOM/noverify/src/git"
+	"github.com/VKCOM/noverify/src/linter"
+	"github.com/VKCOM/noverify/src/meta"
+)
+
+// trendPoint is the stable schema of a single commit in "noverify trend" JSON output.
+// Do not rename or remove fields here, add new ones instead.
+type trendPoint struct {
+	Commit      string         `json:"commit"`
+	Author      string         `json:"author"`
+	Date        string         `json:"date"`
+	Message     string         `json:"message"`
+	Total       int            `json:"total"`
+	Critical    int            `json:"critical"`
+	ByCheck     map[string]int `json:"by_check"`
+	ByDirectory map[string]int `json:"by_directory"`
+}
+
+func newTrendPoint(c git.Commit, reports []*linter.Report) *trendPoint {
+	p := &trendPoint{
+		Commit:      c.Hash,
+		Author:      c.Author,
+		Date:        c.Date.UTC().Format(time.RFC3339),
+		Message:     c.Message,
+		ByCheck:     make(map[string]int),
+		ByDirectory: make(map[string]int),
+	}
+
+	for _, r := range reports {
+		if isExcluded(r) {
+			continue
+		}
+		if r.IsDisabledByUser() && canBeDisabled(r.GetFilename()) {
+			continue
+		}
+
+		p.Total++
+		if r.IsCritical() {
+			p.Critical++
+		}
+		p.ByCheck[r.CheckName()]++
+		p.ByDirectory[statsDirectory(r.GetFilename(), statsDepth)]++
+	}
+
+	return p
+}
+
+// writeTrendCSV writes points in "long" format that is easy to pivot in spreadsheets:
+// every row is a single count of reports in group ("total", "check" or "directory") for a commit.
+func writeTrendCSV(w io.Writer, points []*trendPoint) error {
+	cw := csv.NewWriter(w)
+
+	if err := cw.Write([]string{"commit", "date", "group", "name", "count"}); err != nil {
+		return err
+	}
+
+	writeGroup := func(p *trendPoint, group string, counts map[string]int) error {
+		names := make([]string, 0, len(counts))
+		for name := range counts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			if err := cw.Write([]string{p.Commit, p.Date, group, name, strconv.Itoa(counts[name])}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, p := range points {
+		if err := writeGroup(p, "total", map[string]int{"all": p.Total, "critical": p.Critical}); err != nil {
+			return err
+		}
+		if err := writeGroup(p, "check", p.ByCheck); err != nil {
+			return err
+		}
+		if err := writeGroup(p, "directory", p.ByDirectory); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeTrendJSON(w io.Writer, points []*trendPoint) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(points)
+}
+
+// computeTrend analyzes commits of gitDir in the specified order and returns a point for each of them.
+// Only the first commit is indexed from scratch, files changed between consecutive commits are indexed again.
+func computeTrend(gitDir string, commits []git.Commit) []*trendPoint {
+	points := make([]*trendPoint, 0, len(commits))
+
+	for i, c := range commits {
+		start := time.Now()
+		meta.SetIndexingComplete(false)
+		if i == 0 {
+			linter.ParseFilenames(linter.ReadFilesFromGit(gitDir, c.Hash, nil))
+		} else {
+			changes, err := git.Diff(gitDir, "", []string{commits[i-1].Hash, c.Hash})
+			if err != nil {
+				log.Fatalf("Could not compute git diff: %s", err.Error())
+			}
+			linter.ParseFilenames(linter.ReadFilesFromGitWithChanges(gitDir, c.Hash, changes))
+		}
+		meta.SetIndexingComplete(true)
+		log.Printf("Indexed %s in %s", c.Hash, time.Since(start))
+
+		start = time.Now()
+		reports := linter.ParseFilenames(linter.ReadFilesFromGit(gitDir, c.Hash, reportsExcludeRegex))
+		p := newTrendPoint(c, reports)
+		points = append(points, p)
+		log.Printf("Analyzed %s (%d of %d) in %s: %d reports", c.Hash, i+1, len(commits), time.Since(start), p.Total)
+	}
+
+	return points
+}
+
+// trendMain analyzes last -commits commits of the first-parent history of -git-commit-to (HEAD by default)
+// and writes reports counts for every commit, starting from the oldest one.
+func trendMain() {
+	if gitRepo == "" {
+		log.Fatalf("trend requires -git")
+	}
+	if trendCommits <= 0 {
+		log.Fatalf("-commits must be positive")
+	}
+
+	writeTrend := writeTrendCSV
+	switch trendFormat {
+	case "csv":
+	case "json":
+		writeTrend = writeTrendJSON
+	default:
+		log.Fatalf("Unknown -trend-format %s, only csv and json are supported", trendFormat)
+	}
+
+	rev := gitCommitTo
+	if rev == "" {
+		rev = "HEAD"
+	}
+
+	commits, err := git.Log(gitRepo, []string{"--first-parent", "-n", strconv.Itoa(trendCommits), rev})
+	if err != nil {
+		log.Fatalf("Could not get commits history of %s: %s", rev, err.Error())
+	}
+
+	// log is in reverse chronological order
+	for i, j := 0, len(commits)-1; i < j; i, j = i+1, j-1 {
+		commits[i], commits[j] = commits[j], commits[i]
+	}
+
+	linter.InitStubs()
+	points := computeTrend(gitRepo, commits)
+
+	var w io.Writer = os.Stdout
+	if output != "" {
+		w = outputFp
+	}
+
+	if err := writeTrend(w, points); err != nil {
+		log.Fatalf("Could not write trend: %s", err.Error())
+	}
+}
@@ -0,0 +1,181 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VKCOM/noverify/src/git"
+	"github.com/VKCOM/noverify/src/linter"
+	"github.com/VKCOM/noverify/src/meta"
+)
+
+func runGit(t *testing.T, dir string, args ...string) {
+	t.Helper()
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+	)
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, out)
+	}
+}
+
+// TestComputeTrend checks that incremental indexing of changed files gives the same counts
+// as indexing every commit from scratch.
+func TestComputeTrend(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir, err := ioutil.TempDir("", "noverify-trend")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeFile := func(name, contents string) {
+		t.Helper()
+		filename := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0777); err != nil {
+			t.Fatalf("Could not create directory for %s: %v", name, err)
+		}
+		if err := ioutil.WriteFile(filename, []byte(contents), 0666); err != nil {
+			t.Fatalf("Could not write %s: %v", name, err)
+		}
+	}
+
+	runGit(t, dir, "init", "-q")
+	writeFile("a.php", "<?php\nfunction a() {\n\tc();\n\td();\n\te();\n}\n")
+	writeFile("c.php", "<?php\nfunction c() {}\n")
+	writeFile("d.php", "<?php\nfunction d() {}\n")
+	writeFile("lib/m.php", "<?php\nfunction m() {\n\treturn array(1);\n}\n")
+	runGit(t, dir, "add", "-A")
+	runGit(t, dir, "commit", "-q", "-m", "initial")
+
+	writeFile("e.php", "<?php\nfunction e() {}\n")
+	writeFile("lib/m.php", "<?php\nfunction m() {\n\treturn array(1) + array(2);\n}\n")
+	runGit(t, dir, "mv", "c.php", "lib/c.php")
+	runGit(t, dir, "rm", "-q", "d.php")
+	runGit(t, dir, "add", "-A")
+	runGit(t, dir, "commit", "-q", "-m", "add, modify, rename and delete")
+
+	gitDir := filepath.Join(dir, ".git")
+	commits, err := git.Log(gitDir, []string{"--first-parent", "--reverse", "HEAD"})
+	if err != nil {
+		t.Fatalf("Could not get log: %v", err)
+	}
+	if len(commits) != 2 {
+		t.Fatalf("Expected 2 commits, got %d", len(commits))
+	}
+
+	initTestLinter(t)
+	defer meta.ResetInfo()
+
+	points := computeTrend(gitDir, commits)
+
+	for i, c := range commits {
+		initTestLinter(t)
+		linter.ParseFilenames(linter.ReadFilesFromGit(gitDir, c.Hash, nil))
+		meta.SetIndexingComplete(true)
+		expected := newTrendPoint(c, linter.ParseFilenames(linter.ReadFilesFromGit(gitDir, c.Hash, nil)))
+
+		if expected.Total == 0 {
+			t.Errorf("%s: no reports", c.Message)
+		}
+		if got, want := fmt.Sprintf("%+v", points[i]), fmt.Sprintf("%+v", expected); got != want {
+			t.Errorf("%s: incremental point %s differs from full one %s", c.Message, got, want)
+		}
+	}
+
+	if points[0].ByCheck["undefined"] != 1 || points[1].ByCheck["undefined"] != 1 || points[1].ByCheck["arraySyntax"] != 2 {
+		t.Errorf("Unexpected counts by check: %v and %v", points[0].ByCheck, points[1].ByCheck)
+	}
+}
+
+func TestTrendOutput(t *testing.T) {
+	defer func(depth int) {
+		statsDepth = depth
+		reportsExcludeChecksSet = nil
+	}(statsDepth)
+	statsDepth = 2
+	reportsExcludeChecksSet = map[string]bool{"caseBreak": true}
+
+	var maybe linter.Report
+	err := json.Unmarshal([]byte(fmt.Sprintf(`{"filename": "b.php", "check_name": "phpdoc", "msg": "m", "level": %d}`, linter.LevelDoNotReject)), &maybe)
+	if err != nil {
+		t.Fatalf("Could not decode report: %v", err)
+	}
+
+	c := git.Commit{
+		Hash:    "abc",
+		Author:  "test",
+		Date:    time.Date(2020, 1, 2, 3, 4, 5, 0, time.FixedZone("MSK", 3*3600)),
+		Message: "msg",
+	}
+	p := newTrendPoint(c, []*linter.Report{
+		testReport(t, "src/lib/x/a.php", "unused", "Unused variable x", "$x = 1;"),
+		testReport(t, "src/lib/x/a.php", "undefined", "Undefined variable y", "echo $y;"),
+		&maybe,
+		testReport(t, "src/c.php", "caseBreak", "Add break", "case 1:"),
+	})
+
+	var buf bytes.Buffer
+	if err := writeTrendCSV(&buf, []*trendPoint{p}); err != nil {
+		t.Fatalf("Could not write CSV: %v", err)
+	}
+
+	expectedCSV := strings.Join([]string{
+		"commit,date,group,name,count",
+		"abc,2020-01-02T00:04:05Z,total,all,3",
+		"abc,2020-01-02T00:04:05Z,total,critical,2",
+		"abc,2020-01-02T00:04:05Z,check,phpdoc,1",
+		"abc,2020-01-02T00:04:05Z,check,undefined,1",
+		"abc,2020-01-02T00:04:05Z,check,unused,1",
+		"abc,2020-01-02T00:04:05Z,directory,.,1",
+		"abc,2020-01-02T00:04:05Z,directory,src/lib,2",
+		"",
+	}, "\n")
+	if buf.String() != expectedCSV {
+		t.Errorf("Expected CSV:\n%s\ngot:\n%s", expectedCSV, buf.String())
+	}
+
+	buf.Reset()
+	if err := writeTrendJSON(&buf, []*trendPoint{p}); err != nil {
+		t.Fatalf("Could not write JSON: %v", err)
+	}
+
+	var decoded []map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Could not decode JSON: %v", err)
+	}
+	if len(decoded) != 1 {
+		t.Fatalf("Expected 1 point, got %d", len(decoded))
+	}
+
+	var keys []string
+	for k := range decoded[0] {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	expectedKeys := "author by_check by_directory commit critical date message total"
+	if got := strings.Join(keys, " "); got != expectedKeys {
+		t.Errorf("Expected JSON keys %s, got %s", expectedKeys, got)
+	}
+	if got := fmt.Sprint(decoded[0]["by_directory"]); got != "map[.:1 src/lib:2]" {
+		t.Errorf("Unexpected by_directory %s", got)
+	}
+}
@@ -0,0 +1,271 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/VKCOM/noverify/src/linter"
+	"github.com/VKCOM/noverify/src/meta"
+)
+
+// fileStamp is used to detect file changes without reading file contents.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// watchState contains current reports for every linted file.
+type watchState struct {
+	paths     []string
+	filenames []string
+
+	stamps  map[string]fileStamp
+	reports map[string][]*linter.Report
+}
+
+// collectFilenames returns all files that would be read by linter.ReadFilenames.
+func collectFilenames(cb linter.ReadCallback) []string {
+	ch := make(chan linter.FileInfo)
+	go func() {
+		cb(ch)
+		close(ch)
+	}()
+
+	var res []string
+	for f := range ch {
+		res = append(res, f.Filename)
+	}
+	return res
+}
+
+// readFileList returns callback that reads the specified files.
+func readFileList(filenames []string) linter.ReadCallback {
+	return func(ch chan linter.FileInfo) {
+		for _, filename := range filenames {
+			ch <- linter.FileInfo{Filename: filename}
+		}
+	}
+}
+
+func (s *watchState) scan() map[string]fileStamp {
+	stamps := make(map[string]fileStamp)
+	for _, filename := range collectFilenames(linter.ReadFilenames(s.paths, nil)) {
+		st, err := os.Stat(filename)
+		if err != nil {
+			continue
+		}
+		stamps[filename] = fileStamp{modTime: st.ModTime(), size: st.Size()}
+	}
+	return stamps
+}
+
+func (s *watchState) setReports(filenames []string, reports []*linter.Report) {
+	for _, filename := range filenames {
+		delete(s.reports, filename)
+	}
+	for _, r := range reports {
+		s.reports[r.GetFilename()] = append(s.reports[r.GetFilename()], r)
+	}
+}
+
+// defsFingerprint describes definitions of a file without their positions,
+// so that it only changes when something that can affect other files is changed.
+func defsFingerprint(m meta.PerFile) string {
+	stripFunctions := func(m meta.FunctionsMap) meta.FunctionsMap {
+		res := make(meta.FunctionsMap, len(m))
+		for k, v := range m {
+			v.Pos = meta.ElementPosition{}
+			res[k] = v
+		}
+		return res
+	}
+
+	stripConstants := func(m meta.ConstantsMap) meta.ConstantsMap {
+		res := make(meta.ConstantsMap, len(m))
+		for k, v := range m {
+			v.Pos = meta.ElementPosition{}
+			res[k] = v
+		}
+		return res
+	}
+
+	stripClasses := func(m meta.ClassesMap) meta.ClassesMap {
+		res := make(meta.ClassesMap, len(m))
+		for k, v := range m {
+			v.Pos = meta.ElementPosition{}
+			v.Methods = stripFunctions(v.Methods)
+			v.Constants = stripConstants(v.Constants)
+
+			props := make(meta.PropertiesMap, len(v.Properties))
+			for name, p := range v.Properties {
+				p.Pos = meta.ElementPosition{}
+				props[name] = p
+			}
+			v.Properties = props
+
+			res[k] = v
+		}
+		return res
+	}
+
+	return fmt.Sprintf("%+v %+v %+v %+v", stripClasses(m.Classes), stripClasses(m.Traits), stripFunctions(m.Functions), stripConstants(m.Constants))
+}
+
+func fileDefsFingerprints(filenames []string) map[string]string {
+	meta.Info.Lock()
+	defer meta.Info.Unlock()
+
+	res := make(map[string]string, len(filenames))
+	for _, filename := range filenames {
+		res[filename] = defsFingerprint(meta.Info.GetMetaForFile(filename))
+	}
+	return res
+}
+
+// update indexes changed files and re-lints affected ones.
+// It returns false if nothing has changed.
+func (s *watchState) update() bool {
+	stamps := s.scan()
+
+	var changed, deleted []string
+	for filename, st := range stamps {
+		if prev, ok := s.stamps[filename]; !ok || prev != st {
+			changed = append(changed, filename)
+		}
+	}
+	for filename := range s.stamps {
+		if _, ok := stamps[filename]; !ok {
+			deleted = append(deleted, filename)
+		}
+	}
+	s.stamps = stamps
+
+	if len(changed) == 0 && len(deleted) == 0 {
+		return false
+	}
+
+	start := time.Now()
+	updated := append(append([]string{}, changed...), deleted...)
+	before := fileDefsFingerprints(updated)
+
+	meta.SetIndexingComplete(false)
+	meta.Info.Lock()
+	for _, filename := range deleted {
+		meta.Info.DeleteMetaForFileNonLocked(filename)
+	}
+	meta.Info.Unlock()
+	linter.ParseFilenames(readFileList(changed))
+	meta.SetIndexingComplete(true)
+
+	// when definitions are changed, reports in other files can change as well
+	after := fileDefsFingerprints(updated)
+	defsChanged := false
+	for filename, fp := range after {
+		if before[filename] != fp {
+			defsChanged = true
+			break
+		}
+	}
+
+	lintFilenames := collectFilenames(linter.ReadFilenames(s.filenames, reportsExcludeRegex))
+	lintSet := make(map[string]bool, len(lintFilenames))
+	for _, filename := range lintFilenames {
+		lintSet[filename] = true
+	}
+
+	for filename := range s.reports {
+		if !lintSet[filename] {
+			delete(s.reports, filename)
+		}
+	}
+
+	targets := lintFilenames
+	if !defsChanged {
+		targets = nil
+		for _, filename := range changed {
+			if lintSet[filename] {
+				targets = append(targets, filename)
+			}
+		}
+	}
+
+	s.setReports(targets, linter.ParseFilenames(readFileList(targets)))
+	log.Printf("Processed %d changed and %d deleted files, linted %d files in %s", len(changed), len(deleted), len(targets), time.Since(start))
+
+	return true
+}
+
+// sortedReports returns all current reports in a stable order.
+func (s *watchState) sortedReports() []*linter.Report {
+	var res []*linter.Report
+	for _, list := range s.reports {
+		res = append(res, list...)
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		a, b := res[i], res[j]
+		if a.GetFilename() != b.GetFilename() {
+			return a.GetFilename() < b.GetFilename()
+		}
+		if a.StartLine() != b.StartLine() {
+			return a.StartLine() < b.StartLine()
+		}
+		if a.StartChar() != b.StartChar() {
+			return a.StartChar() < b.StartChar()
+		}
+		if a.CheckName() != b.CheckName() {
+			return a.CheckName() < b.CheckName()
+		}
+		return a.Message() < b.Message()
+	})
+
+	return res
+}
+
+func (s *watchState) print() {
+	if reportsBaseline != nil {
+		reportsBaseline.reset()
+	}
+
+	if outputFormat == outputFormatText {
+		fmt.Fprintf(outputFp, "=== Reports at %s ===\n", time.Now().Format("15:04:05"))
+	}
+
+	criticalReports := analyzeReports(s.sortedReports())
+	log.Printf("Found %d critical reports, watching for changes", criticalReports)
+}
+
+// watchMain does full analysis and then re-lints files as they change, until killed.
+func watchMain(paths, filenames []string) {
+	s := &watchState{
+		paths:     paths,
+		filenames: filenames,
+		reports:   make(map[string][]*linter.Report),
+	}
+
+	s.stamps = s.scan()
+	reports := computeFullReports(paths, filenames, reportsExcludeRegex, func() {
+		linter.ParseFilenames(readFileList(sortedKeys(s.stamps)))
+	})
+	s.setReports(nil, reports)
+	s.print()
+
+	for {
+		time.Sleep(watchInterval)
+		if s.update() {
+			s.print()
+		}
+	}
+}
+
+func sortedKeys(m map[string]fileStamp) []string {
+	res := make([]string, 0, len(m))
+	for k := range m {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
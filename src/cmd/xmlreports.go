@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/VKCOM/noverify/src/linter"
+)
+
+var checkstyleSeverities = map[int]string{
+	linter.LevelError:       "error",
+	linter.LevelWarning:     "warning",
+	linter.LevelInformation: "info",
+	linter.LevelHint:        "info",
+	linter.LevelUnused:      "info",
+	linter.LevelDoNotReject: "warning",
+	linter.LevelSyntax:      "error",
+}
+
+type checkstyleOutput struct {
+	XMLName xml.Name         `xml:"checkstyle"`
+	Version string           `xml:"version,attr"`
+	Files   []checkstyleFile `xml:"file"`
+}
+
+type checkstyleFile struct {
+	Name   string            `xml:"name,attr"`
+	Errors []checkstyleError `xml:"error"`
+}
+
+type checkstyleError struct {
+	Line     int    `xml:"line,attr"`
+	Column   int    `xml:"column,attr"`
+	Severity string `xml:"severity,attr"`
+	Message  string `xml:"message,attr"`
+	Source   string `xml:"source,attr"`
+}
+
+type junitOutput struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// groupReportsByFile returns reports grouped by filename with filenames sorted
+// and reports inside every file sorted by position.
+func groupReportsByFile(reports []*linter.Report) (filenames []string, byFile map[string][]*linter.Report) {
+	byFile = make(map[string][]*linter.Report)
+	for _, r := range reports {
+		filename := r.GetFilename()
+		if _, ok := byFile[filename]; !ok {
+			filenames = append(filenames, filename)
+		}
+		byFile[filename] = append(byFile[filename], r)
+	}
+
+	sort.Strings(filenames)
+	for _, list := range byFile {
+		sort.SliceStable(list, func(i, j int) bool {
+			if list[i].StartLine() != list[j].StartLine() {
+				return list[i].StartLine() < list[j].StartLine()
+			}
+			return list[i].StartChar() < list[j].StartChar()
+		})
+	}
+
+	return filenames, byFile
+}
+
+func writeXML(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func writeCheckstyleReports(w io.Writer, reports []*linter.Report) error {
+	out := checkstyleOutput{Version: "4.3"}
+
+	filenames, byFile := groupReportsByFile(reports)
+	for _, filename := range filenames {
+		f := checkstyleFile{Name: filename}
+		for _, r := range byFile[filename] {
+			f.Errors = append(f.Errors, checkstyleError{
+				Line:     r.StartLine(),
+				Column:   r.StartChar() + 1,
+				Severity: checkstyleSeverities[r.Level()],
+				Message:  r.Message(),
+				Source:   "noverify." + r.CheckName(),
+			})
+		}
+		out.Files = append(out.Files, f)
+	}
+
+	return writeXML(w, &out)
+}
+
+// writeJUnitReports writes every file as a test suite and every report as a test case.
+// Reports that are not critical do not fail the test case and are written to its system-out instead.
+func writeJUnitReports(w io.Writer, reports []*linter.Report) error {
+	out := junitOutput{Name: "noverify"}
+
+	filenames, byFile := groupReportsByFile(reports)
+	for _, filename := range filenames {
+		suite := junitTestSuite{Name: filename}
+		for _, r := range byFile[filename] {
+			tc := junitTestCase{
+				Name:      fmt.Sprintf("%s at line %d", r.CheckName(), r.StartLine()),
+				ClassName: filename,
+			}
+
+			if r.IsCritical() {
+				tc.Failure = &junitFailure{
+					Message: r.Message(),
+					Type:    r.CheckName(),
+					Text:    r.String(),
+				}
+				suite.Failures++
+			} else {
+				tc.SystemOut = r.String()
+			}
+
+			suite.Tests++
+			suite.TestCases = append(suite.TestCases, tc)
+		}
+
+		out.Tests += suite.Tests
+		out.Failures += suite.Failures
+		out.Suites = append(out.Suites, suite)
+	}
+
+	return writeXML(w, &out)
+}
@@ -3,6 +3,7 @@ package git
 import (
 	"bufio"
 	"bytes"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -18,8 +19,15 @@ type Object struct {
 	Contents []byte
 }
 
-// ObjectCatter is used to get objects from git, fast
+// ObjectCatter is used to get objects from git, fast.
+//
+// Objects are read directly from loose object files and packfiles when possible.
+// "git cat-file" is used for everything else, e.g. for revision names like "HEAD^"
+// or for objects from alternate object directories.
 type ObjectCatter struct {
+	gitDir string
+	store  *objectStore // nil if objects can not be read directly
+
 	mu     sync.Mutex
 	cmd    *exec.Cmd
 	stdin  io.WriteCloser
@@ -27,38 +35,57 @@ type ObjectCatter struct {
 	err    error
 }
 
-// NewCatter spawns git so that we can do "cat-file" for objects pretty fast.
+// NewCatter prepares to read objects from the repository.
 func NewCatter(gitDir string) (*ObjectCatter, error) {
-	cmd := exec.Command("git", "--git-dir="+gitDir, "cat-file", "--batch")
+	res := &ObjectCatter{gitDir: gitDir}
+
+	store, err := openObjectStore(gitDir)
+	if err == nil {
+		res.store = store
+		return res, nil
+	}
+
+	// fall back to cat-file for everything, so fail early if it can not be started
+	res.mu.Lock()
+	defer res.mu.Unlock()
+	if err := res.startCatFile(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// startCatFile spawns git so that we can do "cat-file" for objects pretty fast.
+// Must be called with o.mu held.
+func (o *ObjectCatter) startCatFile() error {
+	cmd := exec.Command("git", "--git-dir="+o.gitDir, "cat-file", "--batch")
 
 	stdinPipe, err := cmd.StdinPipe()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	stdoutPipe, err := cmd.StdoutPipe()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	if err := cmd.Start(); err != nil {
-		return nil, err
+		return err
 	}
 
-	res := &ObjectCatter{
-		cmd:    cmd,
-		stdin:  stdinPipe,
-		stdout: bufio.NewReader(stdoutPipe),
-	}
+	o.cmd = cmd
+	o.stdin = stdinPipe
+	o.stdout = bufio.NewReader(stdoutPipe)
 
 	go func() {
 		err := cmd.Wait()
-		res.mu.Lock()
-		res.err = err
-		res.mu.Unlock()
+		o.mu.Lock()
+		o.err = err
+		o.mu.Unlock()
 	}()
 
-	return res, nil
+	return nil
 }
 
 func (o *ObjectCatter) Error() error {
@@ -68,14 +95,32 @@ func (o *ObjectCatter) Error() error {
 	return o.err
 }
 
-// Get returns object with its type and contents.
+// Get returns object with its type and contents. Object can be specified by SHA1 or by any revision name.
+// Returned contents must not be modified. Get is safe for concurrent use.
+func (o *ObjectCatter) Get(sha1 string) (*Object, error) {
+	if o.store != nil && len(sha1) == CommitHashLen {
+		if obj, err := o.store.get(sha1); err == nil {
+			return obj, nil
+		}
+	}
+
+	return o.catFile(sha1)
+}
+
+// catFile returns object using "git cat-file --batch":
 //
 // <sha1> SP <type> SP <size> LF
 // <contents> LF
-func (o *ObjectCatter) Get(sha1 string) (*Object, error) {
+func (o *ObjectCatter) catFile(sha1 string) (*Object, error) {
 	o.mu.Lock()
 	defer o.mu.Unlock()
 
+	if o.cmd == nil {
+		if err := o.startCatFile(); err != nil {
+			return nil, err
+		}
+	}
+
 	_, err := o.stdin.Write([]byte(sha1 + "\n"))
 	if err != nil {
 		return nil, err
@@ -95,6 +140,9 @@ func (o *ObjectCatter) Get(sha1 string) (*Object, error) {
 		return nil, errors.New("Got bad line, perhaps object is missing")
 	}
 
+	// ln points into the reader buffer that is overwritten by the next read
+	typ := string(parts[1])
+
 	size, err := strconv.Atoi(string(parts[2]))
 	if err != nil {
 		return nil, err
@@ -107,54 +155,136 @@ func (o *ObjectCatter) Get(sha1 string) (*Object, error) {
 	}
 
 	return &Object{
-		Type:     string(parts[1]),
+		Type:     typ,
 		Contents: buf[0 : len(buf)-1],
 	}, nil
 }
 
 // Walk traverses tree object treeSHA1 and calls cb() upon encountering any blob that matches filenameFilter()
 func (o *ObjectCatter) Walk(dir string, treeSHA1 string, filenameFilter func(filename []byte) bool, cb func(filename string, contents []byte)) error {
+	return o.WalkParallel(dir, treeSHA1, 1, filenameFilter, cb)
+}
+
+// WalkParallel is like Walk, but blobs are read in the specified number of goroutines,
+// so cb() must be safe for concurrent use. filenameFilter() is always called from a single goroutine.
+func (o *ObjectCatter) WalkParallel(dir string, treeSHA1 string, concurrency int, filenameFilter func(filename []byte) bool, cb func(filename string, contents []byte)) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	type blob struct {
+		filename string
+		sha1     string
+	}
+
+	var (
+		wg       sync.WaitGroup
+		errMu    sync.Mutex
+		firstErr error
+	)
+
+	failed := func() bool {
+		errMu.Lock()
+		defer errMu.Unlock()
+		return firstErr != nil
+	}
+
+	setErr := func(err error) {
+		errMu.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		errMu.Unlock()
+	}
+
+	blobs := make(chan blob, concurrency)
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for b := range blobs {
+				if failed() {
+					continue
+				}
+
+				obj, err := o.Get(b.sha1)
+				if err != nil {
+					setErr(fmt.Errorf("Error getting object for file %s: %s", b.filename, err.Error()))
+					continue
+				}
+
+				cb(b.filename, obj.Contents)
+			}
+		}()
+	}
+
+	err := o.walkTree(dir, treeSHA1, filenameFilter, func(filename string, sha1 string) bool {
+		blobs <- blob{filename: filename, sha1: sha1}
+		return !failed()
+	})
+	if err != nil && err != errStopWalk {
+		setErr(err)
+	}
+
+	close(blobs)
+	wg.Wait()
+
+	return firstErr
+}
+
+// errStopWalk is returned by walkTree when cb() asks to stop.
+var errStopWalk = errors.New("walk stopped")
+
+// walkTree calls cb() for every blob in the tree that matches filenameFilter() until cb() returns false.
+func (o *ObjectCatter) walkTree(dir string, treeSHA1 string, filenameFilter func(filename []byte) bool, cb func(filename string, sha1 string) bool) error {
 	obj, err := o.Get(treeSHA1)
 	if err != nil {
 		return err
 	}
 
 	const (
-		fileTyp = '1'
-		dirTyp  = '4'
-		fileLen = 5
-		dirLen  = 4
+		dirMode     = "40000"
+		gitlinkMode = "160000" // submodule commit
 
 		shaLen = CommitHashLen / 2 // raw length is 2 times less
 	)
 
-	var typeBuf []byte
 	var filenameBuf []byte
-	pos := 0
-
-	for pos < len(obj.Contents) {
-		typ := obj.Contents[pos]
-		pos++
-		switch typ {
-		case fileTyp:
-			typeBuf = obj.Contents[pos : pos+fileLen]
-			pos += fileLen
-		case dirTyp:
-			typeBuf = obj.Contents[pos : pos+dirLen]
-			pos += dirLen
-		default:
-			return fmt.Errorf("Unknown typ: %c", typ)
-		}
-		pos++ // space
+	contents := obj.Contents
 
-		nameLen := bytes.IndexByte(obj.Contents[pos:], 0)
-		filename := obj.Contents[pos : pos+nameLen]
-		pos += nameLen + 1 // nul byte
-
-		sha := obj.Contents[pos : pos+shaLen]
-		pos += shaLen
+	// tree consists of "<mode> SP <filename> NUL <raw sha1>" entries
+	for len(contents) > 0 {
+		spaceIdx := bytes.IndexByte(contents, ' ')
+		if spaceIdx < 0 {
+			return fmt.Errorf("Bad tree %s: no mode", treeSHA1)
+		}
+		mode := string(contents[0:spaceIdx])
+		contents = contents[spaceIdx+1:]
 
-		if typ == fileTyp {
+		nameLen := bytes.IndexByte(contents, 0)
+		if nameLen < 0 || len(contents) < nameLen+1+shaLen {
+			return fmt.Errorf("Bad tree %s: truncated entry", treeSHA1)
+		}
+		filename := contents[0:nameLen]
+		sha := contents[nameLen+1 : nameLen+1+shaLen]
+		contents = contents[nameLen+1+shaLen:]
+
+		switch mode {
+		case gitlinkMode:
+			continue
+		case dirMode:
+			var filePath string
+			if dir == "" {
+				filePath = string(filename) + string(os.PathSeparator)
+			} else {
+				filePath = dir + string(filename) + string(os.PathSeparator)
+			}
+			if err := o.walkTree(filePath, hex.EncodeToString(sha), filenameFilter, cb); err != nil {
+				return err
+			}
+		default:
 			filenameBuf = filenameBuf[0:0]
 			if dir == "" {
 				filenameBuf = append(filenameBuf, filename...)
@@ -167,24 +297,11 @@ func (o *ObjectCatter) Walk(dir string, treeSHA1 string, filenameFilter func(fil
 				continue
 			}
 
-			fileObj, err := o.Get(fmt.Sprintf("%x", sha))
-			if err != nil {
-				return fmt.Errorf("Error getting object for file %s: %s", filename, err.Error())
+			if !cb(string(filenameBuf), hex.EncodeToString(sha)) {
+				return errStopWalk
 			}
-
-			cb(string(filenameBuf), fileObj.Contents)
-		} else if typ == dirTyp {
-			var filePath string
-			if dir == "" {
-				filePath = string(filename) + string(os.PathSeparator)
-			} else {
-				filePath = dir + string(filename) + string(os.PathSeparator)
-			}
-			o.Walk(filePath, fmt.Sprintf("%x", sha), filenameFilter, cb)
 		}
 	}
 
-	_ = typeBuf
-
 	return nil
 }
@@ -10,6 +10,7 @@ import (
 	"os/exec"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // ChangeType describes what happened to the file: it has been deleted, modified, etc.
@@ -53,6 +54,7 @@ type Change struct {
 type Commit struct {
 	Hash    string
 	Author  string
+	Date    time.Time
 	Message string
 }
 
@@ -79,6 +81,10 @@ func readShortLine(rd *bufio.Reader) (ln []byte, skip bool, err error) {
 }
 
 var (
+	diffGitPrefix      = []byte("diff --git ")
+	diffCombinedPrefix = []byte("diff --cc ")
+	renameFromPrefix   = []byte("rename from ")
+	renameToPrefix     = []byte("rename to ")
 	diffOldPrefix      = []byte("--- ")
 	diffOldNamePrefix  = []byte("a/")
 	diffNewPrefix      = []byte("+++ ")
@@ -118,10 +124,20 @@ func Diff(gitDir, workTreeDir string, refspec []string) ([]Change, error) {
 	if workTreeDir != "" {
 		args = append(args, "--work-tree="+workTreeDir)
 	}
-	args = append(args, "diff", "-U0")
+	args = append(args, "diff", "-U0", "-M")
 	args = append(args, refspec...)
 	args = append(args, "--")
 
+	return diff(args)
+}
+
+// DiffStaged computes diff between the commit and the index, i.e. changes that are staged for commit.
+// New file versions can be read using ObjectCatter with ":<filename>" revision names.
+func DiffStaged(gitDir, commit string) ([]Change, error) {
+	return diff([]string{"--git-dir=" + gitDir, "--no-pager", "diff", "--cached", "-U0", "-M", commit, "--"})
+}
+
+func diff(args []string) ([]Change, error) {
 	cmd := exec.Command("git", args...)
 	defer cmd.Wait()
 
@@ -155,9 +171,18 @@ func Diff(gitDir, workTreeDir string, refspec []string) ([]Change, error) {
 	return res, nil
 }
 
-// Fetch does git fetch origin from:to
-func Fetch(gitDir, from, to string) error {
-	args := []string{"--git-dir=" + gitDir, "fetch", "-q", "--no-tags", "origin", from + ":" + to}
+// Fetch does git fetch remote from:to
+func Fetch(gitDir, remote, from, to string) error {
+	return fetch(gitDir, remote, from+":"+to)
+}
+
+// Deepen fetches depth more commits of history from remote into shallow repository
+func Deepen(gitDir, remote string, depth int) error {
+	return fetch(gitDir, "--deepen="+strconv.Itoa(depth), remote)
+}
+
+func fetch(gitDir string, args ...string) error {
+	args = append([]string{"--git-dir=" + gitDir, "fetch", "-q", "--no-tags"}, args...)
 	cmd := exec.Command("git", args...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
@@ -170,7 +195,7 @@ func Fetch(gitDir, from, to string) error {
 // Log computes log in refspec
 func Log(gitDir string, refspec []string) (res []Commit, err error) {
 	args := make([]string, 0, 6+len(refspec))
-	args = append(args, "--git-dir="+gitDir, "--no-pager", "log", "--oneline", "--format=%H/%an/%s")
+	args = append(args, "--git-dir="+gitDir, "--no-pager", "log", "--oneline", "--format=%H/%at/%an/%s")
 	args = append(args, refspec...)
 
 	cmd := exec.Command("git", args...)
@@ -186,12 +211,17 @@ func Log(gitDir string, refspec []string) (res []Commit, err error) {
 		if ln == "" {
 			continue
 		}
-		parts := strings.SplitN(ln, "/", 3)
-		if len(parts) != 3 {
+		parts := strings.SplitN(ln, "/", 4)
+		if len(parts) != 4 {
 			log.Printf("BAD COMMIT LINE: %s", ln)
 			continue
 		}
-		res = append(res, Commit{Hash: parts[0], Author: parts[1], Message: parts[2]})
+		timestamp, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			log.Printf("BAD COMMIT LINE: %s", ln)
+			continue
+		}
+		res = append(res, Commit{Hash: parts[0], Author: parts[2], Date: time.Unix(timestamp, 0), Message: parts[3]})
 	}
 
 	return res, nil
@@ -201,13 +231,17 @@ func parseDiff(rd *bufio.Reader) ([]Change, error) {
 	var res []Change
 	var cur Change
 
-	cur.Valid = true
+	// file names are only parsed in file header, so that changed lines like "--- comment" are not mistaken for them
+	inHeader := false
 
 	for {
 		ln, skip, err := readShortLine(rd)
 		switch {
 		case err == io.EOF:
-			break
+			if cur.OldName != "" {
+				res = append(res, cur)
+			}
+			return res, nil
 		case err != nil:
 			return nil, err
 		case skip:
@@ -215,20 +249,14 @@ func parseDiff(rd *bufio.Reader) ([]Change, error) {
 		}
 
 		switch {
-		case bytes.HasPrefix(ln, diffOldPrefix):
+		case bytes.HasPrefix(ln, diffGitPrefix) || bytes.HasPrefix(ln, diffCombinedPrefix):
 			if cur.OldName != "" {
 				res = append(res, cur)
-				cur.OldName = ""
-				cur.NewName = ""
-				cur.LineRanges = nil
-				cur.OldLineRanges = nil
-				cur.Type = 0
 			}
-
-			cur.parseOld(ln)
-		case bytes.HasPrefix(ln, diffNewPrefix):
-			cur.parseNew(ln)
+			cur = Change{Valid: true}
+			inHeader = true
 		case bytes.HasPrefix(ln, patchHeaderPrefix2) && bytes.Contains(ln, patchHeaderSuffix2):
+			inHeader = false
 			trimmed := bytes.TrimPrefix(ln, patchHeaderPrefix2)
 			suffixIdx := bytes.Index(trimmed, patchHeaderSuffix2)
 			if suffixIdx < 0 {
@@ -238,6 +266,7 @@ func parseDiff(rd *bufio.Reader) ([]Change, error) {
 				return nil, err
 			}
 		case bytes.HasPrefix(ln, patchHeaderPrefix3) && bytes.Contains(ln, patchHeaderSuffix3):
+			inHeader = false
 			trimmed := bytes.TrimPrefix(ln, patchHeaderPrefix3)
 			suffixIdx := bytes.Index(trimmed, patchHeaderSuffix3)
 			if suffixIdx < 0 {
@@ -246,14 +275,20 @@ func parseDiff(rd *bufio.Reader) ([]Change, error) {
 			if err := cur.parsePatchHeader(trimmed[0:suffixIdx]); err != nil {
 				return nil, err
 			}
+		case !inHeader:
+			continue
+		case bytes.HasPrefix(ln, diffOldPrefix):
+			cur.parseOld(ln)
+		case bytes.HasPrefix(ln, diffNewPrefix):
+			cur.parseNew(ln)
+		case bytes.HasPrefix(ln, renameFromPrefix):
+			// pure renames do not have "---" and "+++" lines
+			cur.OldName = string(bytes.TrimPrefix(ln, renameFromPrefix))
+			cur.Type = Changed
+		case bytes.HasPrefix(ln, renameToPrefix):
+			cur.NewName = string(bytes.TrimPrefix(ln, renameToPrefix))
 		}
 	}
-
-	if cur.OldName != "" {
-		res = append(res, cur)
-	}
-
-	return res, nil
 }
 
 // --- a/oldfile
@@ -0,0 +1,228 @@
+package git
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func parseDiffString(t *testing.T, diff string) []Change {
+	t.Helper()
+
+	changes, err := parseDiff(bufio.NewReader(strings.NewReader(diff)))
+	if err != nil {
+		t.Fatalf("Could not parse diff: %v", err)
+	}
+	return changes
+}
+
+func TestParseDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		diff     string
+		expected []Change
+	}{
+		{
+			name: "delete",
+			diff: `diff --git a/a.php b/a.php
+deleted file mode 100644
+index 3b18e51..0000000
+--- a/a.php
++++ /dev/null
+@@ -1,2 +0,0 @@
+-<?php
+-function a() {}
+`,
+			expected: []Change{
+				{
+					Type:          Deleted,
+					OldName:       "a.php",
+					NewName:       "/dev/null",
+					OldLineRanges: []LineRange{{From: 1, To: 2, HaveRange: true, Range: 1}},
+					LineRanges:    []LineRange{{From: 0, To: 0, HaveRange: true, Range: 0}},
+					Valid:         true,
+				},
+			},
+		},
+
+		{
+			name: "rename",
+			diff: `diff --git a/old/a.php b/new/a.php
+similarity index 100%
+rename from old/a.php
+rename to new/a.php
+`,
+			expected: []Change{
+				{Type: Changed, OldName: "old/a.php", NewName: "new/a.php", Valid: true},
+			},
+		},
+
+		{
+			name: "rename with modification",
+			diff: `diff --git a/old/a.php b/new/a.php
+similarity index 80%
+rename from old/a.php
+rename to new/a.php
+index 3b18e51..1d7e5b1 100644
+--- a/old/a.php
++++ b/new/a.php
+@@ -3 +3 @@ function a() {}
+--- removed comment line
++++ added comment line
+`,
+			expected: []Change{
+				{
+					Type:          Changed,
+					OldName:       "old/a.php",
+					NewName:       "new/a.php",
+					OldLineRanges: []LineRange{{From: 3, To: 3}},
+					LineRanges:    []LineRange{{From: 3, To: 3}},
+					Valid:         true,
+				},
+			},
+		},
+
+		{
+			name: "several files",
+			diff: `diff --git a/a.php b/a.php
+deleted file mode 100644
+index 3b18e51..0000000
+--- a/a.php
++++ /dev/null
+@@ -1 +0,0 @@
+-<?php
+diff --git a/b.php b/c.php
+similarity index 100%
+rename from b.php
+rename to c.php
+diff --git a/d.php b/d.php
+new file mode 100644
+index 0000000..3b18e51
+--- /dev/null
++++ b/d.php
+@@ -0,0 +1 @@
++<?php
+`,
+			expected: []Change{
+				{
+					Type:          Deleted,
+					OldName:       "a.php",
+					NewName:       "/dev/null",
+					OldLineRanges: []LineRange{{From: 1, To: 1}},
+					LineRanges:    []LineRange{{From: 0, To: 0, HaveRange: true, Range: 0}},
+					Valid:         true,
+				},
+				{Type: Changed, OldName: "b.php", NewName: "c.php", Valid: true},
+				{
+					Type:          Added,
+					OldName:       "/dev/null",
+					NewName:       "d.php",
+					OldLineRanges: []LineRange{{From: 0, To: 0, HaveRange: true, Range: 0}},
+					LineRanges:    []LineRange{{From: 1, To: 1}},
+					Valid:         true,
+				},
+			},
+		},
+
+		{
+			name: "empty",
+			diff: ``,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			changes := parseDiffString(t, test.diff)
+			if !reflect.DeepEqual(changes, test.expected) {
+				t.Errorf("Unexpected changes:\n%+v\nexpected:\n%+v", changes, test.expected)
+			}
+		})
+	}
+}
+
+func TestDiffRenames(t *testing.T) {
+	dir := newTestRepo(t)
+	defer os.RemoveAll(dir)
+
+	gitDir := filepath.Join(dir, ".git")
+
+	runGit(t, dir, "rm", "-q", "dir0/file.php")
+	runGit(t, dir, "mv", "dir1/file.php", "dir1/renamed.php")
+	runGit(t, dir, "mv", "dir2/file.php", "dir2/modified.php")
+	contents, err := ioutil.ReadFile(filepath.Join(dir, "dir2", "modified.php"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents = append(contents, "function added() {}\n"...)
+	if err := ioutil.WriteFile(filepath.Join(dir, "dir2", "modified.php"), contents, 0666); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, dir, "add", "-A")
+	runGit(t, dir, "commit", "-q", "-m", "delete and rename")
+
+	changes, err := Diff(gitDir, "", []string{"HEAD^", "HEAD"})
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+
+	var got []string
+	for _, c := range changes {
+		got = append(got, c.Type.String()+" "+c.OldName+" -> "+c.NewName)
+	}
+
+	expected := []string{
+		"Deleted dir0/file.php -> /dev/null",
+		"Changed dir1/file.php -> dir1/renamed.php",
+		"Changed dir2/file.php -> dir2/modified.php",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Unexpected changes:\n%s\nexpected:\n%s", strings.Join(got, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+func TestDiffStaged(t *testing.T) {
+	dir := newTestRepo(t)
+	defer os.RemoveAll(dir)
+
+	gitDir := filepath.Join(dir, ".git")
+
+	staged := filepath.Join(dir, "dir0", "file.php")
+	if err := ioutil.WriteFile(staged, []byte("<?php // staged\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, dir, "add", "dir0/file.php")
+
+	// unstaged changes must be ignored, including new contents of the staged file
+	if err := ioutil.WriteFile(staged, []byte("<?php // unstaged\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "dir1", "file.php"), []byte("<?php // unstaged\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := DiffStaged(gitDir, "HEAD")
+	if err != nil {
+		t.Fatalf("DiffStaged failed: %v", err)
+	}
+
+	if len(changes) != 1 || changes[0].NewName != "dir0/file.php" || changes[0].Type != Changed {
+		t.Fatalf("Unexpected changes: %+v", changes)
+	}
+
+	catter, err := NewCatter(gitDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	obj, err := catter.Get(":" + changes[0].NewName)
+	if err != nil {
+		t.Fatalf("Could not read staged file: %v", err)
+	}
+	if string(obj.Contents) != "<?php // staged\n" {
+		t.Errorf("Unexpected staged contents: %q", obj.Contents)
+	}
+}
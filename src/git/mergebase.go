@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"errors"
 	"log"
+	"os"
 	"os/exec"
+	"path/filepath"
 )
 
 // MergeBase computes merge base between commits one and two
@@ -27,3 +29,25 @@ func MergeBase(gitDir string, one, two string) (res string, err error) {
 
 	return string(out), nil
 }
+
+// RevParse returns hash of the commit that ref points to
+func RevParse(gitDir string, ref string) (res string, err error) {
+	out, err := exec.Command("git", "--git-dir="+gitDir, "rev-parse", "-q", "--verify", ref+"^{commit}").Output()
+	if err != nil {
+		return "", err
+	}
+
+	out = bytes.TrimSpace(out)
+
+	if len(out) != CommitHashLen {
+		return "", errors.New("Too short hash")
+	}
+
+	return string(out), nil
+}
+
+// IsShallow reports whether or not repository is a shallow clone, so that some history can be missing
+func IsShallow(gitDir string) bool {
+	_, err := os.Stat(filepath.Join(gitDir, "shallow"))
+	return err == nil
+}
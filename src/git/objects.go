@@ -0,0 +1,580 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// errObjectNotFound means that object is not stored in loose objects or packfiles,
+// e.g. it is in alternates or it does not exist at all.
+var errObjectNotFound = errors.New("object not found")
+
+// maxDeltaCacheSize limits total size of delta bases that are kept in memory.
+const maxDeltaCacheSize = 64 * 1024 * 1024
+
+var objectTypeNames = [...]string{
+	1: "commit",
+	2: "tree",
+	3: "blob",
+	4: "tag",
+}
+
+const (
+	packObjOfsDelta = 6
+	packObjRefDelta = 7
+)
+
+// objectStore reads objects directly from .git/objects without spawning git.
+// It is safe for concurrent use.
+type objectStore struct {
+	objectsDir string
+
+	mu        sync.Mutex
+	packs     []*packFile
+	packsTime time.Time
+
+	cacheMu   sync.Mutex
+	cache     map[packCacheKey]*Object
+	cacheSize int
+}
+
+type packCacheKey struct {
+	pack   *packFile
+	offset uint64
+}
+
+var objectStores struct {
+	sync.Mutex
+	m map[string]*objectStore
+}
+
+// openObjectStore returns object store for the repository. Stores are shared between callers,
+// so that pack indexes are read only once.
+func openObjectStore(gitDir string) (*objectStore, error) {
+	objectsDir, err := filepath.Abs(filepath.Join(gitDir, "objects"))
+	if err != nil {
+		return nil, err
+	}
+
+	if st, err := os.Stat(objectsDir); err != nil {
+		return nil, err
+	} else if !st.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", objectsDir)
+	}
+
+	objectStores.Lock()
+	defer objectStores.Unlock()
+
+	if s, ok := objectStores.m[objectsDir]; ok {
+		return s, nil
+	}
+
+	s := &objectStore{
+		objectsDir: objectsDir,
+		cache:      make(map[packCacheKey]*Object),
+	}
+	if err := s.loadPacks(); err != nil {
+		return nil, err
+	}
+
+	if objectStores.m == nil {
+		objectStores.m = make(map[string]*objectStore)
+	}
+	objectStores.m[objectsDir] = s
+
+	return s, nil
+}
+
+// loadPacks opens packfiles that are not opened yet. Packs that were removed (e.g. by git gc)
+// are kept open because their objects are still readable and are present in the new packs too.
+func (s *objectStore) loadPacks() error {
+	packDir := filepath.Join(s.objectsDir, "pack")
+
+	st, err := os.Stat(packDir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !st.ModTime().After(s.packsTime) && s.packs != nil {
+		return nil
+	}
+	s.packsTime = st.ModTime()
+
+	idxFiles, err := filepath.Glob(filepath.Join(packDir, "*.idx"))
+	if err != nil {
+		return err
+	}
+
+	opened := make(map[string]bool, len(s.packs))
+	for _, p := range s.packs {
+		opened[p.idxFilename] = true
+	}
+
+	for _, idxFilename := range idxFiles {
+		if opened[idxFilename] {
+			continue
+		}
+
+		p, err := openPackFile(idxFilename)
+		if err != nil {
+			return err
+		}
+		s.packs = append(s.packs, p)
+	}
+
+	if s.packs == nil {
+		s.packs = []*packFile{}
+	}
+
+	return nil
+}
+
+func (s *objectStore) currentPacks() []*packFile {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.packs
+}
+
+// get returns object by its hex SHA1.
+func (s *objectStore) get(sha1 string) (*Object, error) {
+	raw, err := hex.DecodeString(sha1)
+	if err != nil || len(raw) != CommitHashLen/2 {
+		return nil, fmt.Errorf("invalid object name %s", sha1)
+	}
+
+	obj, err := s.getRaw(raw)
+	if err != errObjectNotFound {
+		return obj, err
+	}
+
+	// new packs could have appeared after repack or fetch
+	if err := s.loadPacks(); err != nil {
+		return nil, err
+	}
+	return s.getRaw(raw)
+}
+
+func (s *objectStore) getRaw(sha []byte) (*Object, error) {
+	for _, p := range s.currentPacks() {
+		if offset, ok := p.find(sha); ok {
+			return s.readPacked(p, offset)
+		}
+	}
+
+	return s.readLoose(hex.EncodeToString(sha))
+}
+
+// readLoose reads zlib-compressed "<type> SP <size> NUL <contents>" object file.
+func (s *objectStore) readLoose(sha1 string) (*Object, error) {
+	fp, err := os.Open(filepath.Join(s.objectsDir, sha1[0:2], sha1[2:]))
+	if os.IsNotExist(err) {
+		return nil, errObjectNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	rd := getBufioReader(fp)
+	defer bufioReaders.Put(rd)
+
+	zr, err := getZlibReader(rd)
+	if err != nil {
+		return nil, err
+	}
+	defer zlibReaders.Put(zr)
+
+	data, err := ioutil.ReadAll(zr)
+	if err != nil {
+		return nil, err
+	}
+
+	nul := bytes.IndexByte(data, 0)
+	if nul < 0 {
+		return nil, fmt.Errorf("bad loose object %s header", sha1)
+	}
+
+	header := bytes.Fields(data[0:nul])
+	if len(header) != 2 {
+		return nil, fmt.Errorf("bad loose object %s header", sha1)
+	}
+
+	size, err := strconv.Atoi(string(header[1]))
+	if err != nil || size != len(data)-nul-1 {
+		return nil, fmt.Errorf("bad loose object %s size", sha1)
+	}
+
+	return &Object{Type: string(header[0]), Contents: data[nul+1:]}, nil
+}
+
+// readPacked reads object from the packfile resolving deltas.
+func (s *objectStore) readPacked(p *packFile, offset uint64) (*Object, error) {
+	key := packCacheKey{pack: p, offset: offset}
+
+	s.cacheMu.Lock()
+	obj, ok := s.cache[key]
+	s.cacheMu.Unlock()
+	if ok {
+		return obj, nil
+	}
+
+	typ, data, base, err := p.readEntry(offset)
+	if err != nil {
+		return nil, err
+	}
+
+	var baseObj *Object
+
+	switch typ {
+	case packObjOfsDelta:
+		baseObj, err = s.readPacked(p, base.offset)
+		if err == nil {
+			s.cacheDeltaBase(packCacheKey{pack: p, offset: base.offset}, baseObj)
+		}
+	case packObjRefDelta:
+		baseObj, err = s.getRaw(base.sha)
+	default:
+		if typ <= 0 || typ >= len(objectTypeNames) || objectTypeNames[typ] == "" {
+			return nil, fmt.Errorf("unknown object type %d in %s at offset %d", typ, p.packFilename, offset)
+		}
+		return &Object{Type: objectTypeNames[typ], Contents: data}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	contents, err := applyDelta(baseObj.Contents, data)
+	if err != nil {
+		return nil, fmt.Errorf("bad delta in %s at offset %d: %s", p.packFilename, offset, err.Error())
+	}
+
+	return &Object{Type: baseObj.Type, Contents: contents}, nil
+}
+
+// cacheDeltaBase remembers delta base, because objects with the same base are usually read one after another.
+func (s *objectStore) cacheDeltaBase(key packCacheKey, obj *Object) {
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+
+	if _, ok := s.cache[key]; ok {
+		return
+	}
+
+	if s.cacheSize+len(obj.Contents) > maxDeltaCacheSize {
+		s.cache = make(map[packCacheKey]*Object)
+		s.cacheSize = 0
+	}
+	s.cache[key] = obj
+	s.cacheSize += len(obj.Contents)
+}
+
+// packFile is a packfile with its index.
+type packFile struct {
+	idxFilename  string
+	packFilename string
+
+	fp *os.File
+
+	fanout  [256]uint32
+	shas    []byte // sorted raw SHA1s
+	offsets []uint64
+}
+
+func openPackFile(idxFilename string) (*packFile, error) {
+	idx, err := ioutil.ReadFile(idxFilename)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &packFile{
+		idxFilename:  idxFilename,
+		packFilename: idxFilename[0:len(idxFilename)-len(".idx")] + ".pack",
+	}
+
+	if err := p.parseIndex(idx); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %s", idxFilename, err.Error())
+	}
+
+	p.fp, err = os.Open(p.packFilename)
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+var idxV2Magic = []byte{0377, 't', 'O', 'c'}
+
+// parseIndex parses .idx file in version 1 or version 2 format.
+func (p *packFile) parseIndex(idx []byte) error {
+	const shaLen = CommitHashLen / 2
+
+	version := 1
+	if bytes.HasPrefix(idx, idxV2Magic) {
+		if len(idx) < 8 {
+			return errors.New("truncated header")
+		}
+		version = int(binary.BigEndian.Uint32(idx[4:8]))
+		if version != 2 {
+			return fmt.Errorf("unsupported version %d", version)
+		}
+		idx = idx[8:]
+	}
+
+	if len(idx) < 256*4 {
+		return errors.New("truncated fanout table")
+	}
+	for i := range p.fanout {
+		p.fanout[i] = binary.BigEndian.Uint32(idx[i*4:])
+	}
+	idx = idx[256*4:]
+
+	n := int(p.fanout[255])
+	p.shas = make([]byte, n*shaLen)
+	p.offsets = make([]uint64, n)
+
+	if version == 1 {
+		const entryLen = 4 + shaLen
+		if len(idx) < n*entryLen {
+			return errors.New("truncated entries")
+		}
+		for i := 0; i < n; i++ {
+			entry := idx[i*entryLen:]
+			p.offsets[i] = uint64(binary.BigEndian.Uint32(entry))
+			copy(p.shas[i*shaLen:], entry[4:entryLen])
+		}
+		return nil
+	}
+
+	if len(idx) < n*(shaLen+4+4) {
+		return errors.New("truncated entries")
+	}
+	copy(p.shas, idx[0:n*shaLen])
+	offsets := idx[n*(shaLen+4):] // skip CRC32 table
+	large := offsets[n*4:]
+
+	for i := 0; i < n; i++ {
+		offset := binary.BigEndian.Uint32(offsets[i*4:])
+		if offset&0x80000000 == 0 {
+			p.offsets[i] = uint64(offset)
+			continue
+		}
+
+		largeIdx := int(offset & 0x7fffffff)
+		if len(large) < (largeIdx+1)*8 {
+			return errors.New("truncated large offsets table")
+		}
+		p.offsets[i] = binary.BigEndian.Uint64(large[largeIdx*8:])
+	}
+
+	return nil
+}
+
+// find returns offset of the object in packfile.
+func (p *packFile) find(sha []byte) (offset uint64, ok bool) {
+	const shaLen = CommitHashLen / 2
+
+	lo := 0
+	if sha[0] > 0 {
+		lo = int(p.fanout[sha[0]-1])
+	}
+	hi := int(p.fanout[sha[0]])
+
+	i := lo + sort.Search(hi-lo, func(i int) bool {
+		return bytes.Compare(p.shas[(lo+i)*shaLen:(lo+i+1)*shaLen], sha) >= 0
+	})
+
+	if i < hi && bytes.Equal(p.shas[i*shaLen:(i+1)*shaLen], sha) {
+		return p.offsets[i], true
+	}
+
+	return 0, false
+}
+
+// deltaBase is a reference to delta base object: offset is set for OFS_DELTA and sha for REF_DELTA.
+type deltaBase struct {
+	offset uint64
+	sha    []byte
+}
+
+// readers are reused because allocating zlib and bufio readers for every object is expensive.
+var (
+	bufioReaders sync.Pool
+	zlibReaders  sync.Pool
+)
+
+func getBufioReader(r io.Reader) *bufio.Reader {
+	if rd, ok := bufioReaders.Get().(*bufio.Reader); ok {
+		rd.Reset(r)
+		return rd
+	}
+	return bufio.NewReader(r)
+}
+
+func getZlibReader(r io.Reader) (io.ReadCloser, error) {
+	if zr, ok := zlibReaders.Get().(io.ReadCloser); ok {
+		if err := zr.(zlib.Resetter).Reset(r, nil); err != nil {
+			return nil, err
+		}
+		return zr, nil
+	}
+	return zlib.NewReader(r)
+}
+
+// readEntry reads packfile entry header and its decompressed data.
+func (p *packFile) readEntry(offset uint64) (typ int, data []byte, base deltaBase, err error) {
+	rd := getBufioReader(io.NewSectionReader(p.fp, int64(offset), 1<<62))
+	defer bufioReaders.Put(rd)
+
+	c, err := rd.ReadByte()
+	if err != nil {
+		return 0, nil, base, err
+	}
+
+	typ = int(c>>4) & 7
+	size := uint64(c & 0x0f)
+	shift := uint(4)
+	for c&0x80 != 0 {
+		if c, err = rd.ReadByte(); err != nil {
+			return 0, nil, base, err
+		}
+		size |= uint64(c&0x7f) << shift
+		shift += 7
+	}
+
+	switch typ {
+	case packObjOfsDelta:
+		if c, err = rd.ReadByte(); err != nil {
+			return 0, nil, base, err
+		}
+		rel := uint64(c & 0x7f)
+		for c&0x80 != 0 {
+			if c, err = rd.ReadByte(); err != nil {
+				return 0, nil, base, err
+			}
+			rel = ((rel + 1) << 7) | uint64(c&0x7f)
+		}
+		if rel > offset {
+			return 0, nil, base, fmt.Errorf("bad delta base offset in %s at offset %d", p.packFilename, offset)
+		}
+		base.offset = offset - rel
+	case packObjRefDelta:
+		base.sha = make([]byte, CommitHashLen/2)
+		if _, err := io.ReadFull(rd, base.sha); err != nil {
+			return 0, nil, base, err
+		}
+	}
+
+	zr, err := getZlibReader(rd)
+	if err != nil {
+		return 0, nil, base, err
+	}
+	defer zlibReaders.Put(zr)
+
+	data = make([]byte, size)
+	if _, err := io.ReadFull(zr, data); err != nil {
+		return 0, nil, base, fmt.Errorf("could not read object from %s at offset %d: %s", p.packFilename, offset, err.Error())
+	}
+
+	return typ, data, base, nil
+}
+
+// applyDelta applies git delta instructions to the base object contents.
+func applyDelta(base, delta []byte) ([]byte, error) {
+	readSize := func() (uint64, error) {
+		var size uint64
+		var shift uint
+		for {
+			if len(delta) == 0 {
+				return 0, errors.New("truncated size")
+			}
+			c := delta[0]
+			delta = delta[1:]
+			size |= uint64(c&0x7f) << shift
+			shift += 7
+			if c&0x80 == 0 {
+				return size, nil
+			}
+		}
+	}
+
+	srcSize, err := readSize()
+	if err != nil {
+		return nil, err
+	}
+	if srcSize != uint64(len(base)) {
+		return nil, fmt.Errorf("base size mismatch: expected %d, got %d", srcSize, len(base))
+	}
+
+	dstSize, err := readSize()
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]byte, 0, dstSize)
+
+	for len(delta) > 0 {
+		op := delta[0]
+		delta = delta[1:]
+
+		switch {
+		case op&0x80 != 0:
+			// copy from base: bits 0-3 say which offset bytes are present, bits 4-6 are for size bytes
+			var offset, size uint64
+			for i := uint(0); i < 7; i++ {
+				if op&(1<<i) == 0 {
+					continue
+				}
+				if len(delta) == 0 {
+					return nil, errors.New("truncated copy instruction")
+				}
+				if i < 4 {
+					offset |= uint64(delta[0]) << (8 * i)
+				} else {
+					size |= uint64(delta[0]) << (8 * (i - 4))
+				}
+				delta = delta[1:]
+			}
+			if size == 0 {
+				size = 0x10000
+			}
+			if offset+size > uint64(len(base)) {
+				return nil, errors.New("copy out of base bounds")
+			}
+			res = append(res, base[offset:offset+size]...)
+		case op != 0:
+			// insert next op bytes
+			if int(op) > len(delta) {
+				return nil, errors.New("truncated insert instruction")
+			}
+			res = append(res, delta[0:op]...)
+			delta = delta[op:]
+		default:
+			return nil, errors.New("reserved instruction")
+		}
+	}
+
+	if uint64(len(res)) != dstSize {
+		return nil, fmt.Errorf("result size mismatch: expected %d, got %d", dstSize, len(res))
+	}
+
+	return res, nil
+}
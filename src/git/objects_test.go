@@ -0,0 +1,171 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+	)
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, out)
+	}
+	return string(out)
+}
+
+// newTestRepo creates repository with a history of similar files, so that packs contain deltas.
+func newTestRepo(t *testing.T) (dir string) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir, err := ioutil.TempDir("", "noverify-git-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runGit(t, dir, "init", "-q")
+
+	var body strings.Builder
+	for i := 0; i < 20; i++ {
+		fmt.Fprintf(&body, "function f%d() { return %d; }\n", i, i)
+		for j := 0; j < 3; j++ {
+			filename := filepath.Join(dir, fmt.Sprintf("dir%d", j), "file.php")
+			if err := os.MkdirAll(filepath.Dir(filename), 0777); err != nil {
+				t.Fatal(err)
+			}
+			contents := fmt.Sprintf("<?php // %d\n%s", j, body.String())
+			if err := ioutil.WriteFile(filename, []byte(contents), 0666); err != nil {
+				t.Fatal(err)
+			}
+		}
+		runGit(t, dir, "add", "-A")
+		runGit(t, dir, "commit", "-q", "-m", fmt.Sprintf("commit %d", i))
+	}
+
+	return dir
+}
+
+func allObjects(t *testing.T, gitDir string) []string {
+	out := runGit(t, gitDir, "cat-file", "--batch-all-objects", "--batch-check=%(objectname)")
+	return strings.Fields(out)
+}
+
+func checkObjectsEqual(t *testing.T, gitDir string) {
+	t.Helper()
+
+	store, err := openObjectStore(gitDir)
+	if err != nil {
+		t.Fatalf("Could not open object store: %v", err)
+	}
+
+	catter := &ObjectCatter{gitDir: gitDir}
+
+	objects := allObjects(t, gitDir)
+	if len(objects) == 0 {
+		t.Fatalf("No objects in repository")
+	}
+
+	for _, sha1 := range objects {
+		native, err := store.get(sha1)
+		if err != nil {
+			t.Fatalf("Could not read %s natively: %v", sha1, err)
+		}
+
+		expected, err := catter.catFile(sha1)
+		if err != nil {
+			t.Fatalf("Could not read %s with cat-file: %v", sha1, err)
+		}
+
+		if native.Type != expected.Type || !bytes.Equal(native.Contents, expected.Contents) {
+			t.Errorf("Object %s differs: got %s %q, expected %s %q", sha1, native.Type, native.Contents, expected.Type, expected.Contents)
+		}
+	}
+}
+
+func TestReadObjects(t *testing.T) {
+	dir := newTestRepo(t)
+	defer os.RemoveAll(dir)
+
+	gitDir := filepath.Join(dir, ".git")
+
+	t.Run("loose", func(t *testing.T) {
+		checkObjectsEqual(t, gitDir)
+	})
+
+	for _, version := range []string{"1", "2"} {
+		runGit(t, dir, "-c", "pack.indexVersion="+version, "repack", "-q", "-a", "-d", "-f", "--depth=10", "--window=10")
+		// pack indexes are cached per repository
+		objectStores.Lock()
+		delete(objectStores.m, filepath.Join(gitDir, "objects"))
+		objectStores.Unlock()
+
+		t.Run("pack-idx-v"+version, func(t *testing.T) {
+			checkObjectsEqual(t, gitDir)
+		})
+	}
+}
+
+func TestWalkParallel(t *testing.T) {
+	dir := newTestRepo(t)
+	defer os.RemoveAll(dir)
+
+	gitDir := filepath.Join(dir, ".git")
+	runGit(t, dir, "repack", "-q", "-a", "-d")
+
+	catter, err := NewCatter(gitDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err := GetTreeSHA1(catter, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	walk := func(concurrency int) []string {
+		var mu sync.Mutex
+		var res []string
+
+		err := catter.WalkParallel("", tree, concurrency, func(filename []byte) bool {
+			return bytes.HasSuffix(filename, []byte(".php"))
+		}, func(filename string, contents []byte) {
+			mu.Lock()
+			res = append(res, filename+": "+string(contents))
+			mu.Unlock()
+		})
+		if err != nil {
+			t.Fatalf("Walk failed: %v", err)
+		}
+
+		sort.Strings(res)
+		return res
+	}
+
+	sequential := walk(1)
+	if len(sequential) != 3 {
+		t.Fatalf("Expected 3 files, got %d", len(sequential))
+	}
+
+	parallel := walk(4)
+	if strings.Join(sequential, "\n") != strings.Join(parallel, "\n") {
+		t.Errorf("Parallel walk results differ:\n%v\nexpected:\n%v", parallel, sequential)
+	}
+}
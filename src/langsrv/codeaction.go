@@ -0,0 +1,85 @@
+package langsrv
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/VKCOM/noverify/src/lintdebug"
+	"github.com/VKCOM/noverify/src/linter"
+	"github.com/VKCOM/noverify/src/vscode"
+)
+
+// offsetToPosition converts 0-based byte offset in file to the language server position.
+func offsetToPosition(linesPositions []int, offset int) vscode.Position {
+	line := sort.Search(len(linesPositions), func(i int) bool { return linesPositions[i] > offset }) - 1
+	if line < 0 {
+		line = 0
+	}
+
+	var lineStart int
+	if line < len(linesPositions) {
+		lineStart = linesPositions[line]
+	}
+
+	return vscode.Position{Line: line, Character: offset - lineStart}
+}
+
+func rangesIntersect(a, b vscode.Range) bool {
+	before := func(x, y vscode.Position) bool {
+		return x.Line < y.Line || (x.Line == y.Line && x.Character < y.Character)
+	}
+	return !before(a.End, b.Start) && !before(b.End, a.Start)
+}
+
+func fixToCodeAction(uri string, linesPositions []int, f linter.DiagnosticFix) vscode.CodeAction {
+	edits := make([]vscode.TextEdit, 0, len(f.Fix.Edits))
+	for _, e := range f.Fix.Edits {
+		edits = append(edits, vscode.TextEdit{
+			Range: vscode.Range{
+				Start: offsetToPosition(linesPositions, e.Start),
+				End:   offsetToPosition(linesPositions, e.End),
+			},
+			NewText: e.Replacement,
+		})
+	}
+
+	return vscode.CodeAction{
+		Title:       f.Fix.Title,
+		Kind:        "quickfix",
+		Diagnostics: []vscode.Diagnostic{f.Diagnostic},
+		Edit:        &vscode.WorkspaceEdit{Changes: map[string][]vscode.TextEdit{uri: edits}},
+	}
+}
+
+func handleTextDocumentCodeAction(req *baseRequest) error {
+	var params vscode.CodeActionParams
+	if err := json.Unmarshal([]byte(req.Params), &params); err != nil {
+		return err
+	}
+
+	uri := params.TextDocument.URI
+	filename := strings.TrimPrefix(uri, "file://")
+
+	openMapMutex.Lock()
+	f, ok := openMap[filename]
+	openMapMutex.Unlock()
+
+	result := make([]vscode.CodeAction, 0)
+
+	if !ok {
+		lintdebug.Send("File is not opened, but code actions requested: %s", filename)
+	} else {
+		for _, fix := range f.fixes {
+			if rangesIntersect(fix.Diagnostic.Range, params.Range) {
+				result = append(result, fixToCodeAction(uri, f.linesPositions, fix))
+			}
+		}
+	}
+
+	return writeMessage(&response{
+		JSONRPC: req.JSONRPC,
+		ID:      req.ID,
+		Result:  result,
+	})
+}
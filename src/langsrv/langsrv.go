@@ -53,6 +53,10 @@ func (methodCall) IMessage() {}
 var (
 	respMutex sync.Mutex
 	connWr    io.Writer
+
+	// ConfigOverrides is applied to the config from the workspace root (or to an empty one if there is none),
+	// e.g. to add severity overrides from command line. It must compile the config.
+	ConfigOverrides func(cfg *linter.Config) error
 )
 
 // RegisterDebug starts listening for debug events
@@ -126,6 +130,8 @@ func handleMessage(buf []byte) error {
 		return handleTextDocumentHover(&req)
 	case "textDocument/documentSymbol":
 		return handleTextDocumentSymbol(&req)
+	case "textDocument/codeAction":
+		return handleTextDocumentCodeAction(&req)
 	case "workspace/didChangeWatchedFiles":
 		return handleChangeWatchedFiles(&req)
 	default:
@@ -143,6 +149,32 @@ func handleMessage(buf []byte) error {
 	})
 }
 
+// loadRootConfig returns config from the workspace root with ConfigOverrides applied to it.
+// Nil is returned if there is neither config nor overrides.
+func loadRootConfig(root string) *linter.Config {
+	var cfg *linter.Config
+	if filename := linter.FindConfig(root); filename != "" {
+		var err error
+		cfg, err = linter.LoadConfig(filename)
+		if err != nil {
+			lintdebug.Send("Could not load config: %s", err.Error())
+		}
+	}
+
+	if ConfigOverrides == nil {
+		return cfg
+	}
+
+	if cfg == nil {
+		cfg = linter.NewConfig(root)
+	}
+	if err := ConfigOverrides(cfg); err != nil {
+		lintdebug.Send("Could not apply config overrides: %s", err.Error())
+		return nil
+	}
+	return cfg
+}
+
 func handleInitialize(req *baseRequest) error {
 	var params vscode.InitializeParams
 	if err := json.Unmarshal([]byte(req.Params), &params); err != nil {
@@ -151,6 +183,13 @@ func handleInitialize(req *baseRequest) error {
 
 	lintdebug.Send("Root dir: %s", params.RootPath)
 
+	// config passed in command line takes precedence over the one in project root
+	if linter.GetConfig() == nil {
+		if cfg := loadRootConfig(params.RootPath); cfg != nil {
+			linter.SetConfig(cfg)
+		}
+	}
+
 	go func() {
 		linter.AnalysisFiles = []string{params.RootPath}
 
@@ -172,7 +211,7 @@ func handleInitialize(req *baseRequest) error {
 		ID:      req.ID,
 		Result: map[string]interface{}{
 			"capabilities": map[string]interface{}{
-				"codeActionProvider":               nil,
+				"codeActionProvider":               true,
 				"codeLensProvider":                 nil,
 				"textDocumentSync":                 1, // FULL
 				"documentSymbolProvider":           true,
@@ -24,6 +24,7 @@ type openedFile struct {
 	positions      position.Positions
 	lines          [][]byte
 	linesPositions []int
+	fixes          []linter.DiagnosticFix
 }
 
 var (
@@ -87,9 +88,10 @@ func changeFileNonLocked(filename, contents string) {
 	newWalker.InitCustom()
 	rootNode.Walk(newWalker)
 	linter.AnalyzeFileRootLevel(rootNode, newWalker)
+	newWalker.ReportUnusedSuppressions()
 
 	openMapMutex.Lock()
-	f := openedFile{rootNode, contents, w.Scopes, w.Positions, w.Lines, w.LinesPositions}
+	f := openedFile{rootNode, contents, w.Scopes, w.Positions, w.Lines, w.LinesPositions, newWalker.Fixes}
 	openMap[filename] = f
 	openMapMutex.Unlock()
 
@@ -126,6 +128,10 @@ func concurrentParseChanges(changes []vscode.FileEvent) {
 		}()
 	}
 	wg.Wait()
+
+	if err := linter.FlushCache(); err != nil {
+		lintdebug.Send("Could not flush cache: %s", err.Error())
+	}
 }
 
 func convertEncodingIfNeeded(contents []byte) []byte {
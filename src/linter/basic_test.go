@@ -654,3 +654,180 @@ func TestStringGlobalVarName(t *testing.T) {
 		global ${"${x}_{$x}"};
 	}`)
 }
+
+func TestIgnoreDirective(t *testing.T) {
+	reports := getReportsSimple(t, `<?php
+	function f() {
+		echo $x; // noverify-ignore undefined: legacy code
+		// noverify-ignore undefined
+		echo $y;
+		echo $z; // noverify-ignore caseBreak
+		$_ = array(1); // noverify-ignore
+	}
+
+	/** @noverify-ignore undefined */
+	function g() {
+		echo $a;
+		return array(1);
+	}
+
+	/**
+	 * @noverify-ignore arraySyntax, deadCode
+	 */
+	class C {
+		public function m() {
+			return array(1);
+		}
+	}
+	`)
+
+	for _, r := range reports {
+		log.Printf("%s", r)
+	}
+
+	if len(reports) != 4 {
+		t.Errorf("Unexpected number of reports: expected 4, got %d", len(reports))
+	}
+
+	if !hasReport(reports, "Undefined variable: z") {
+		t.Errorf("No error about undefined $z")
+	}
+	if !hasReport(reports, "Unused noverify-ignore for caseBreak") {
+		t.Errorf("No error about unused caseBreak suppression")
+	}
+	if !hasReport(reports, "Use of old array syntax") {
+		t.Errorf("No error about array() syntax in g()")
+	}
+	if !hasReport(reports, "Unused @noverify-ignore for deadCode") {
+		t.Errorf("No error about unused deadCode suppression")
+	}
+}
+
+func TestIgnoreDirectiveInStrings(t *testing.T) {
+	reports := getReportsSimple(t, `<?php
+	function f() {
+		$s = "# noverify-ignore";
+		echo $x, $s;
+		$h = <<<EOT
+// noverify-ignore undefined
+EOT;
+		echo $y, $h;
+		echo "привет"; /* noverify-ignore undefined */ echo $z;
+	}
+	`)
+
+	for _, r := range reports {
+		log.Printf("%s", r)
+	}
+
+	if len(reports) != 2 {
+		t.Errorf("Unexpected number of reports: expected 2, got %d", len(reports))
+	}
+
+	if !hasReport(reports, "Undefined variable: x") {
+		t.Errorf("No error about undefined $x")
+	}
+	if !hasReport(reports, "Undefined variable: y") {
+		t.Errorf("No error about undefined $y")
+	}
+}
+
+func TestFixes(t *testing.T) {
+	contents := `<?php
+	function f($a) {
+		$x = array(1, array(2));
+		switch ($a) {
+		case 1:
+			echo 1;
+		case 2:
+			echo 2;
+		}
+	}`
+
+	reports := getReportsSimple(t, contents)
+
+	var fixes []*Fix
+	for _, r := range reports {
+		if r.Fix() != nil {
+			fixes = append(fixes, r.Fix())
+		}
+	}
+
+	res, applied := ApplyFixes([]byte(contents), fixes)
+	if len(applied) != len(fixes) || len(fixes) != 4 {
+		t.Errorf("Unexpected number of fixes: expected 4, got %d (%d applied)", len(fixes), len(applied))
+	}
+
+	expected := `<?php
+	function f($a) {
+		$_ = [1, [2]];
+		switch ($a) {
+		case 1:
+			echo 1;
+		// fallthrough
+		case 2:
+			echo 2;
+		}
+	}`
+
+	if string(res) != expected {
+		t.Errorf("Unexpected fix result:\n%s\nexpected:\n%s", res, expected)
+	}
+}
+
+func TestApplyFixesOverlap(t *testing.T) {
+	fixes := []*Fix{
+		{Edits: []TextEdit{{Start: 0, End: 3, Replacement: "x"}}},
+		{Edits: []TextEdit{{Start: 2, End: 4, Replacement: "y"}}},
+		{Edits: []TextEdit{{Start: 4, End: 4, Replacement: "z"}, {Start: 5, End: 6, Replacement: "w"}}},
+		{Edits: []TextEdit{{Start: -1, End: -1, Replacement: "bad"}}},
+	}
+
+	res, applied := ApplyFixes([]byte("abcdef"), fixes)
+	if string(res) != "xdzew" {
+		t.Errorf("Unexpected result: %s", res)
+	}
+	if len(applied) != 2 {
+		t.Errorf("Unexpected number of applied fixes: expected 2, got %d", len(applied))
+	}
+}
+
+func TestDeclaredChecksExamples(t *testing.T) {
+	// these examples need either stubs or too much code to trigger the check
+	skip := map[string]bool{
+		"complexity":   true,
+		"stdInterface": true,
+	}
+
+	hasCheck := func(reports []*Report, name string) bool {
+		for _, r := range reports {
+			if r.CheckName() == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, info := range GetDeclaredChecks() {
+		if skip[info.Name] {
+			continue
+		}
+
+		if !hasCheck(getReportsSimple(t, "<?php\n"+info.Before), info.Name) {
+			t.Errorf("Check %s is not reported for its bad example:\n%s", info.Name, info.Before)
+		}
+		if hasCheck(getReportsSimple(t, "<?php\n"+info.After), info.Name) {
+			t.Errorf("Check %s is reported for its good example:\n%s", info.Name, info.After)
+		}
+	}
+}
+
+func TestDeclareCheckDuplicate(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected panic for duplicate check declaration")
+		}
+	}()
+
+	DeclareCheck(CheckInfo{Name: "undefined"})
+}
@@ -117,6 +117,11 @@ func (b *BlockWalker) Report(n node.Node, level int, checkName, msg string, args
 	b.r.Report(n, level, checkName, msg, args...)
 }
 
+// ReportWithFix registers a report with an automatic fix. Fix can be nil.
+func (b *BlockWalker) ReportWithFix(n node.Node, level int, checkName string, fix *Fix, msg string, args ...interface{}) {
+	b.r.ReportWithFix(n, level, checkName, fix, msg, args...)
+}
+
 // ClassParseState returns class parse state (namespace, current class, etc)
 func (b *BlockWalker) ClassParseState() *meta.ClassParseState {
 	return b.r.st
@@ -941,7 +946,7 @@ func (b *BlockWalker) handleStaticPropertyFetch(e *expr.StaticPropertyFetch) boo
 }
 
 func (b *BlockWalker) handleArray(arr *expr.Array) bool {
-	b.r.Report(arr, LevelDoNotReject, "arraySyntax", "Use of old array syntax (use short form instead)")
+	b.r.ReportWithFix(arr, LevelDoNotReject, "arraySyntax", b.r.arraySyntaxFix(arr), "Use of old array syntax (use short form instead)")
 	return b.handleArrayItems(arr, arr.Items)
 }
 
@@ -1454,7 +1459,7 @@ func (b *BlockWalker) handleSwitch(s *stmt.Switch) bool {
 			// allow the fallthrough if appropriate comment is present
 			nextCase := s.Cases[idx+1]
 			if !b.caseHasFallthroughComment(nextCase) {
-				b.r.Report(c, LevelInformation, "caseBreak", "Add break or '// fallthrough' to the end of the case")
+				b.r.ReportWithFix(c, LevelInformation, "caseBreak", b.r.fallthroughFix(nextCase), "Add break or '// fallthrough' to the end of the case")
 			}
 		}
 
@@ -1679,7 +1684,11 @@ func (b *BlockWalker) flushUnused() {
 			}
 
 			visitedMap[n] = struct{}{}
-			b.r.Report(n, LevelUnused, "unused", `Unused variable %s (use $_ to ignore this inspection)`, name)
+			var fix *Fix
+			if _, ok := n.(*expr.Variable); ok {
+				fix = &Fix{Title: "Rename to $_", Edits: []TextEdit{b.r.ReplaceNodeEdit(n, "$_")}}
+			}
+			b.r.ReportWithFix(n, LevelUnused, "unused", fix, `Unused variable %s (use $_ to ignore this inspection)`, name)
 		}
 	}
 }
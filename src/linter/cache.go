@@ -2,14 +2,19 @@ package linter
 
 import (
 	"bufio"
+	"bytes"
 	"crypto/md5"
 	"encoding/gob"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"io"
+	"log"
 	"os"
 	"path/filepath"
+	"reflect"
 	"runtime"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -34,9 +39,157 @@ type fileMeta struct {
 	FunctionOverrides meta.FunctionsOverrideMap
 }
 
+// cacheNamespace returns name of the CacheDir subdirectory that is used by this build.
+// Builds with different cache versions or custom checkers never share entries,
+// old namespaces are not removed automatically.
+func cacheNamespace() (string, error) {
+	h := fnv.New32a()
+	for _, info := range GetDeclaredChecks() {
+		fmt.Fprintf(h, "check %s\n", info.Name)
+	}
+	for _, fn := range customBlockLinters {
+		fmt.Fprintf(h, "block %s\n", runtime.FuncForPC(reflect.ValueOf(fn).Pointer()).Name())
+	}
+	for _, fn := range customRootLinters {
+		fmt.Fprintf(h, "root %s\n", runtime.FuncForPC(reflect.ValueOf(fn).Pointer()).Name())
+	}
+
+	// custom checkers with the same names can do different things in different builds,
+	// and cacheVersion is not changed when they do
+	if len(customBlockLinters) != 0 || len(customRootLinters) != 0 {
+		id, err := buildID()
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "build %s\n", id)
+	}
+
+	return fmt.Sprintf("v%d-%08x", cacheVersion, h.Sum32()), nil
+}
+
+// buildID returns identity of the running build. It is a variable so that tests can change it.
+var buildID = executableHash
+
+// executableHashResult is md5 of the running executable, it is computed only once.
+var executableHashResult struct {
+	sync.Once
+	sum string
+	err error
+}
+
+// executableHash returns md5 of the running executable.
+func executableHash() (string, error) {
+	r := &executableHashResult
+	r.Do(func() {
+		filename, err := os.Executable()
+		if err != nil {
+			r.err = err
+			return
+		}
+
+		fp, err := os.Open(filename)
+		if err != nil {
+			r.err = err
+			return
+		}
+		defer fp.Close()
+
+		h := md5.New()
+		if _, err := io.Copy(h, fp); err != nil {
+			r.err = err
+			return
+		}
+		r.sum = fmt.Sprintf("%x", h.Sum(nil))
+	})
+	return r.sum, r.err
+}
+
+// metaCache is the cache store in CacheDir, it is opened when it is used for the first time.
+var metaCache struct {
+	sync.Mutex
+	dir   string
+	store *cacheStore
+}
+
+// getMetaCache returns cache store for CacheDir or nil if cache can not be used.
+func getMetaCache() *cacheStore {
+	metaCache.Lock()
+	defer metaCache.Unlock()
+
+	if metaCache.dir == CacheDir {
+		return metaCache.store
+	}
+
+	if metaCache.store != nil {
+		metaCache.store.close()
+	}
+
+	metaCache.dir = CacheDir
+	metaCache.store = nil
+	if CacheDir == "" {
+		return nil
+	}
+
+	namespace, err := cacheNamespace()
+	if err != nil {
+		log.Printf("Could not identify build for cache in %s, not using it: %s", CacheDir, err.Error())
+		return nil
+	}
+
+	store, err := openCacheStore(filepath.Join(CacheDir, namespace))
+	if err != nil {
+		log.Printf("Could not open cache in %s, not using it: %s", CacheDir, err.Error())
+		return nil
+	}
+
+	metaCache.store = store
+	return store
+}
+
+// FlushCache saves cache index, so that entries written and used so far are known to the next runs.
+// It is called after indexing, so there is no need to call it unless files are parsed using Parse directly.
+func FlushCache() error {
+	if CacheDir == "" {
+		return nil
+	}
+
+	store := getMetaCache()
+	if store == nil {
+		return nil
+	}
+
+	return store.flush()
+}
+
+// CompactCache removes cache entries for contents that were not seen by the last run that used the cache
+// and also removes per-file cache entries that were used by old versions.
+func CompactCache() (kept, dropped int, err error) {
+	if CacheDir == "" {
+		return 0, 0, errors.New("cache directory is not specified")
+	}
+
+	store := getMetaCache()
+	if store == nil {
+		return 0, 0, fmt.Errorf("could not open cache in %s", CacheDir)
+	}
+
+	kept, dropped, err = store.compact()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	legacy, err := removeLegacyCacheFiles(CacheDir)
+	return kept, dropped + legacy, err
+}
+
 // Parse file and fill in the meta info. Can use cache.
 func Parse(filename string, contents []byte, encoding string) error {
-	if CacheDir == "" {
+	var store *cacheStore
+	if CacheDir != "" {
+		store = getMetaCache()
+	}
+
+	if store == nil {
 		_, w, err := ParseContents(filename, contents, encoding, nil)
 		if w != nil {
 			updateMetaInfo(filename, &w.meta)
@@ -61,81 +214,36 @@ func Parse(filename string, contents []byte, encoding string) error {
 		h.Write(contents)
 	}
 
-	contentsHash := fmt.Sprintf("%x", h.Sum(nil))
-
-	cacheFilenamePart := filename
-
-	// windows user supplied full path to directory to be analyzed,
-	// but windows paths does not support ":" in the middle
-	if len(filename) > 2 && filename[0] >= 'A' && filename[0] <= 'Z' && filename[1] == ':' {
-		cacheFilenamePart = string(filename[0:1]) + "_" + string(filename[2:])
-	}
-
-	cacheFile := filepath.Join(CacheDir, cacheFilenamePart+"."+contentsHash)
+	key := filename + "\x00" + fmt.Sprintf("%x", h.Sum(nil))
 
 	start := time.Now()
-	fp, err := os.Open(cacheFile)
-	if err != nil {
-		_, w, err := ParseContents(filename, contents, encoding, nil)
-		if err != nil {
-			return err
-		}
-
-		return createMetaCacheFile(filename, cacheFile, &w.meta)
-	}
-	defer fp.Close()
-
-	if err := restoreMetaFromCache(filename, fp); err != nil {
-		// do not really care about why exactly reading from cache failed
-		os.Remove(cacheFile)
-
-		_, w, err := ParseContents(filename, contents, encoding, nil)
-		if err != nil {
-			return err
+	if data, ok := store.get(key); ok {
+		// do not really care about why exactly reading from cache failed, the entry is written again below
+		if err := restoreMetaFromCache(filename, bytes.NewReader(data)); err == nil {
+			atomic.AddInt64(&initCacheReadTime, int64(time.Since(start)))
+			return nil
 		}
-
-		return createMetaCacheFile(filename, cacheFile, &w.meta)
 	}
 
-	atomic.AddInt64(&initCacheReadTime, int64(time.Since(start)))
-	return nil
-}
-
-func createMetaCacheFile(filename, cacheFile string, m *fileMeta) error {
-	tmpPath := cacheFile + ".tmp"
-	os.MkdirAll(filepath.Dir(tmpPath), 0777)
-
-	// TODO: some kind of file-based locking
-	fp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	_, w, err := ParseContents(filename, contents, encoding, nil)
 	if err != nil {
 		return err
 	}
-	defer fp.Close()
-	defer os.Remove(tmpPath)
 
-	wr := bufio.NewWriter(fp)
-	if err := wr.WriteByte(cacheVersion); err != nil {
-		return err
-	}
+	return createMetaCacheEntry(store, filename, key, &w.meta)
+}
 
-	enc := gob.NewEncoder(wr)
+func createMetaCacheEntry(store *cacheStore, filename, key string, m *fileMeta) error {
+	var buf bytes.Buffer
+	buf.WriteByte(cacheVersion)
 
-	if err := enc.Encode(m); err != nil {
-		return err
-	}
+	enc := gob.NewEncoder(&buf)
 
-	if err := wr.Flush(); err != nil {
+	if err := enc.Encode(m); err != nil {
 		return err
 	}
-	
-	// Windows clearly does not want to allow to rename unclosed files
-	if runtime.GOOS == "windows" {
-		fp.Close()
-		os.Remove(cacheFile)
-	}
-
 
-	if err := os.Rename(tmpPath, cacheFile); err != nil {
+	if err := store.put(key, buf.Bytes()); err != nil {
 		return err
 	}
 
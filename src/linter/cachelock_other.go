@@ -0,0 +1,15 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !windows
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!windows
+
+package linter
+
+import "os"
+
+// lockFile does nothing on platforms without file locking, cache must not be shared between processes there.
+func lockFile(fp *os.File, exclusive bool) error {
+	return nil
+}
+
+func unlockFile(fp *os.File) error {
+	return nil
+}
@@ -0,0 +1,656 @@
+package linter
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// cacheStore keeps values in a single append-only segment file and an index of record offsets.
+//
+// Segment consists of records:
+//
+//	<key length uint32> <value length uint32> <crc32 of key and value uint32> <key> <value>
+//
+// Index file is written when cache is flushed, records that were appended after that (e.g. by a process
+// that did not finish) are recovered by scanning the segment from the end of indexed part.
+// Every index entry remembers the last run that used it, so that compaction can drop entries
+// for contents that are not seen anymore.
+//
+// All methods are safe for concurrent use, also by different processes: appending records, writing index
+// and compaction take exclusive advisory lock on the lock file. Records are never modified after they
+// are written and compaction writes a new segment generation, so readers do not need the lock.
+type cacheStore struct {
+	dir  string
+	lock *os.File
+
+	mu    sync.RWMutex
+	gen   uint32
+	data  *os.File
+	size  int64 // end of the last valid record in data
+	index map[string]*cacheEntry
+
+	prevRun uint32 // run that flushed the index last time
+	run     uint32
+	dirty   int32
+}
+
+type cacheEntry struct {
+	offset  int64
+	length  uint32 // record length, including header
+	lastRun uint32
+}
+
+// cacheIndex is the contents of index file.
+type cacheIndex struct {
+	gen     uint32
+	run     uint32
+	size    int64
+	entries map[string]*cacheEntry
+}
+
+const (
+	cacheIndexMagic   = "NVCX"
+	cacheIndexVersion = 1
+
+	cacheRecordHeaderLen = 12
+
+	// maxCacheRecordLen protects from huge allocations when segment is corrupted.
+	maxCacheRecordLen = 1 << 30
+)
+
+var errBadCacheIndex = errors.New("bad cache index")
+
+func cacheIndexPath(dir string) string {
+	return filepath.Join(dir, "cache.idx")
+}
+
+func cacheSegmentPath(dir string, gen uint32) string {
+	return filepath.Join(dir, "cache."+strconv.FormatUint(uint64(gen), 10)+".seg")
+}
+
+func cacheLockPath(dir string) string {
+	return filepath.Join(dir, "cache.lock")
+}
+
+// openCacheStore opens cache store in dir, creating it if needed. Index that can not be read is ignored,
+// in this case cache is effectively empty.
+func openCacheStore(dir string) (*cacheStore, error) {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, err
+	}
+
+	lock, err := os.OpenFile(cacheLockPath(dir), os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &cacheStore{dir: dir, lock: lock}
+
+	err = s.withFileLock(false, func() error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if err := s.reloadLocked(); err != nil {
+			return err
+		}
+		s.run = s.prevRun + 1
+		return nil
+	})
+	if err != nil {
+		lock.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// withFileLock calls fn() with advisory lock on the lock file held, so that other processes do not write
+// to the store at the same time.
+func (s *cacheStore) withFileLock(exclusive bool, fn func() error) error {
+	if err := lockFile(s.lock, exclusive); err != nil {
+		return fmt.Errorf("could not lock cache: %v", err)
+	}
+	defer unlockFile(s.lock)
+
+	return fn()
+}
+
+// reloadLocked reads index and opens segment of the current generation.
+// Must be called with s.mu held for writing and with the file lock.
+func (s *cacheStore) reloadLocked() error {
+	idx, err := readCacheIndex(s.dir)
+	if err != nil {
+		idx = &cacheIndex{entries: make(map[string]*cacheEntry)}
+	}
+
+	fp, err := os.OpenFile(cacheSegmentPath(s.dir, idx.gen), os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+
+	st, err := fp.Stat()
+	if err != nil {
+		fp.Close()
+		return err
+	}
+	if st.Size() < idx.size {
+		// segment does not match the index, start from scratch
+		idx.size = 0
+		idx.entries = make(map[string]*cacheEntry)
+	}
+
+	if s.data != nil {
+		s.data.Close()
+	}
+
+	s.gen, s.data, s.size, s.index = idx.gen, fp, idx.size, idx.entries
+	s.prevRun = idx.run
+	s.recoverLocked()
+
+	return nil
+}
+
+// syncLocked makes sure that the store uses the current segment generation and knows about all records in it.
+// Must be called with s.mu held for writing and with the exclusive file lock.
+func (s *cacheStore) syncLocked() error {
+	gen, err := readCacheIndexGen(s.dir)
+	if err == nil && gen != s.gen {
+		// segment was compacted by another process
+		run := s.run
+		if err := s.reloadLocked(); err != nil {
+			return err
+		}
+		s.run = run
+		return nil
+	}
+
+	s.recoverLocked()
+	return nil
+}
+
+// readCacheIndexGen only reads segment generation from index file header.
+func readCacheIndexGen(dir string) (uint32, error) {
+	fp, err := os.Open(cacheIndexPath(dir))
+	if err != nil {
+		return 0, err
+	}
+	defer fp.Close()
+
+	rd := bufio.NewReader(io.LimitReader(fp, 64))
+	magic := make([]byte, len(cacheIndexMagic))
+	if _, err := io.ReadFull(rd, magic); err != nil {
+		return 0, err
+	}
+	if string(magic) != cacheIndexMagic {
+		return 0, errBadCacheIndex
+	}
+	if ver, err := binary.ReadUvarint(rd); err != nil || ver != cacheIndexVersion {
+		return 0, errBadCacheIndex
+	}
+	gen, err := binary.ReadUvarint(rd)
+	return uint32(gen), err
+}
+
+// readCacheIndex reads index file: header, entries and crc32 of everything before it.
+func readCacheIndex(dir string) (idx *cacheIndex, err error) {
+	buf, err := ioutil.ReadFile(cacheIndexPath(dir))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(buf) < len(cacheIndexMagic)+4 || string(buf[0:len(cacheIndexMagic)]) != cacheIndexMagic {
+		return nil, errBadCacheIndex
+	}
+
+	body := buf[0 : len(buf)-4]
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(buf[len(buf)-4:]) {
+		return nil, errBadCacheIndex
+	}
+
+	rd := bytes.NewReader(body[len(cacheIndexMagic):])
+	readUvarint := func() uint64 {
+		v, e := binary.ReadUvarint(rd)
+		if e != nil && err == nil {
+			err = e
+		}
+		return v
+	}
+
+	if readUvarint() != cacheIndexVersion {
+		return nil, errBadCacheIndex
+	}
+
+	idx = &cacheIndex{
+		gen:  uint32(readUvarint()),
+		run:  uint32(readUvarint()),
+		size: int64(readUvarint()),
+	}
+	count := readUvarint()
+	if err != nil {
+		return nil, err
+	}
+
+	idx.entries = make(map[string]*cacheEntry, count)
+	for i := uint64(0); i < count; i++ {
+		keyLen := readUvarint()
+		if err != nil || keyLen > uint64(rd.Len()) {
+			return nil, errBadCacheIndex
+		}
+		key := make([]byte, keyLen)
+		rd.Read(key)
+
+		e := &cacheEntry{
+			offset:  int64(readUvarint()),
+			length:  uint32(readUvarint()),
+			lastRun: uint32(readUvarint()),
+		}
+		if err != nil {
+			return nil, err
+		}
+		idx.entries[string(key)] = e
+	}
+
+	return idx, nil
+}
+
+// recoverLocked adds records that were appended after s.size to the index.
+// Scan stops at the first incomplete or corrupted record, next write overwrites it.
+// Must be called with s.mu held for writing.
+func (s *cacheStore) recoverLocked() {
+	for {
+		key, length, err := s.readRecordHeader(s.size)
+		if err != nil {
+			return
+		}
+		s.index[key] = &cacheEntry{offset: s.size, length: length, lastRun: s.prevRun}
+		s.size += int64(length)
+	}
+}
+
+// readRecordHeader checks the record at the offset and returns its key and length.
+func (s *cacheStore) readRecordHeader(offset int64) (key string, length uint32, err error) {
+	rec, err := readCacheRecord(s.data, offset, 0)
+	if err != nil {
+		return "", 0, err
+	}
+	keyLen := binary.LittleEndian.Uint32(rec[0:4])
+	return string(rec[cacheRecordHeaderLen : cacheRecordHeaderLen+keyLen]), uint32(len(rec)), nil
+}
+
+// readCacheRecord reads the whole record at the offset and verifies it. If length is 0, it is read from the header.
+func readCacheRecord(data *os.File, offset int64, length uint32) ([]byte, error) {
+	if length == 0 {
+		var hdr [cacheRecordHeaderLen]byte
+		if _, err := data.ReadAt(hdr[:], offset); err != nil {
+			return nil, err
+		}
+		recLen := uint64(cacheRecordHeaderLen) + uint64(binary.LittleEndian.Uint32(hdr[0:4])) + uint64(binary.LittleEndian.Uint32(hdr[4:8]))
+		if recLen > maxCacheRecordLen {
+			return nil, fmt.Errorf("too long cache record at %d", offset)
+		}
+		length = uint32(recLen)
+	}
+
+	if length < cacheRecordHeaderLen {
+		return nil, fmt.Errorf("bad cache record at %d", offset)
+	}
+
+	rec := make([]byte, length)
+	if _, err := data.ReadAt(rec, offset); err != nil {
+		return nil, err
+	}
+
+	keyLen := uint64(binary.LittleEndian.Uint32(rec[0:4]))
+	valueLen := uint64(binary.LittleEndian.Uint32(rec[4:8]))
+	if cacheRecordHeaderLen+keyLen+valueLen != uint64(length) {
+		return nil, fmt.Errorf("bad cache record length at %d", offset)
+	}
+	if crc32.ChecksumIEEE(rec[cacheRecordHeaderLen:]) != binary.LittleEndian.Uint32(rec[8:12]) {
+		return nil, fmt.Errorf("bad cache record checksum at %d", offset)
+	}
+
+	return rec, nil
+}
+
+// get returns value for the key and marks the entry as used in the current run.
+// Returned value must not be modified.
+func (s *cacheStore) get(key string) (value []byte, ok bool) {
+	s.mu.RLock()
+	e, ok := s.index[key]
+	data, run := s.data, s.run
+	s.mu.RUnlock()
+
+	if !ok {
+		return nil, false
+	}
+
+	// compaction could replace the segment, so read from the one that matches the entry
+	rec, err := readCacheRecord(data, e.offset, e.length)
+	if err != nil {
+		return nil, false
+	}
+
+	keyLen := binary.LittleEndian.Uint32(rec[0:4])
+	if string(rec[cacheRecordHeaderLen:cacheRecordHeaderLen+keyLen]) != key {
+		return nil, false
+	}
+
+	if atomic.LoadUint32(&e.lastRun) != run {
+		atomic.StoreUint32(&e.lastRun, run)
+		atomic.StoreInt32(&s.dirty, 1)
+	}
+
+	return rec[cacheRecordHeaderLen+keyLen:], true
+}
+
+// put appends value for the key to the segment. The whole record is written at once under exclusive lock
+// and is protected by checksum, so it is either seen completely or not seen at all.
+func (s *cacheStore) put(key string, value []byte) error {
+	rec := make([]byte, cacheRecordHeaderLen+len(key)+len(value))
+	binary.LittleEndian.PutUint32(rec[0:4], uint32(len(key)))
+	binary.LittleEndian.PutUint32(rec[4:8], uint32(len(value)))
+	copy(rec[cacheRecordHeaderLen:], key)
+	copy(rec[cacheRecordHeaderLen+len(key):], value)
+	binary.LittleEndian.PutUint32(rec[8:12], crc32.ChecksumIEEE(rec[cacheRecordHeaderLen:]))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.withFileLock(true, func() error {
+		if err := s.syncLocked(); err != nil {
+			return err
+		}
+
+		if _, err := s.data.WriteAt(rec, s.size); err != nil {
+			return err
+		}
+
+		s.index[key] = &cacheEntry{offset: s.size, length: uint32(len(rec)), lastRun: s.run}
+		s.size += int64(len(rec))
+		atomic.StoreInt32(&s.dirty, 1)
+
+		return nil
+	})
+}
+
+// flush writes index if anything was changed or used since the last flush.
+func (s *cacheStore) flush() error {
+	if atomic.LoadInt32(&s.dirty) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.withFileLock(true, func() error {
+		if err := s.syncLocked(); err != nil {
+			return err
+		}
+		s.mergeIndexLocked()
+
+		atomic.StoreInt32(&s.dirty, 0)
+		return s.writeIndexLocked()
+	})
+}
+
+// mergeIndexLocked adds usage marks from index that could be written by other processes.
+// Must be called with s.mu held for writing and with the exclusive file lock.
+func (s *cacheStore) mergeIndexLocked() {
+	idx, err := readCacheIndex(s.dir)
+	if err != nil || idx.gen != s.gen {
+		return
+	}
+
+	if idx.run > s.prevRun {
+		s.prevRun = idx.run
+	}
+
+	for key, disk := range idx.entries {
+		e, ok := s.index[key]
+		if ok && e.offset == disk.offset && disk.lastRun > atomic.LoadUint32(&e.lastRun) {
+			atomic.StoreUint32(&e.lastRun, disk.lastRun)
+		}
+	}
+}
+
+// writeIndexLocked atomically replaces index file.
+// Must be called with s.mu held for writing and with the exclusive file lock.
+func (s *cacheStore) writeIndexLocked() error {
+	run := s.run
+	if s.prevRun > run {
+		run = s.prevRun
+	}
+
+	var buf bytes.Buffer
+	var tmp [binary.MaxVarintLen64]byte
+	writeUvarint := func(v uint64) {
+		buf.Write(tmp[:binary.PutUvarint(tmp[:], v)])
+	}
+
+	buf.WriteString(cacheIndexMagic)
+	writeUvarint(cacheIndexVersion)
+	writeUvarint(uint64(s.gen))
+	writeUvarint(uint64(run))
+	writeUvarint(uint64(s.size))
+	writeUvarint(uint64(len(s.index)))
+	for key, e := range s.index {
+		writeUvarint(uint64(len(key)))
+		buf.WriteString(key)
+		writeUvarint(uint64(e.offset))
+		writeUvarint(uint64(e.length))
+		writeUvarint(uint64(atomic.LoadUint32(&e.lastRun)))
+	}
+
+	binary.LittleEndian.PutUint32(tmp[0:4], crc32.ChecksumIEEE(buf.Bytes()))
+	buf.Write(tmp[0:4])
+
+	return writeFileAtomic(cacheIndexPath(s.dir), buf.Bytes())
+}
+
+// compact rewrites segment to a new generation that only has entries used by the last run
+// (or by the current one) and returns number of kept and dropped entries.
+func (s *cacheStore) compact() (kept, dropped int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err = s.withFileLock(true, func() error {
+		if err := s.syncLocked(); err != nil {
+			return err
+		}
+		s.mergeIndexLocked()
+
+		kept, dropped, err = s.compactLocked()
+		return err
+	})
+
+	return kept, dropped, err
+}
+
+// compactLocked must be called with s.mu held for writing and with the exclusive file lock.
+func (s *cacheStore) compactLocked() (kept, dropped int, err error) {
+	keys := make([]string, 0, len(s.index))
+	for key := range s.index {
+		keys = append(keys, key)
+	}
+	// read old segment sequentially
+	sort.Slice(keys, func(i, j int) bool { return s.index[keys[i]].offset < s.index[keys[j]].offset })
+
+	gen := s.gen + 1
+	fp, err := os.OpenFile(cacheSegmentPath(s.dir, gen), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	index := make(map[string]*cacheEntry, len(keys))
+	wr := bufio.NewWriter(fp)
+	var size int64
+
+	for _, key := range keys {
+		e := s.index[key]
+		if e.lastRun < s.prevRun {
+			dropped++
+			continue
+		}
+
+		rec, err := readCacheRecord(s.data, e.offset, e.length)
+		if err != nil {
+			dropped++
+			continue
+		}
+
+		if _, err := wr.Write(rec); err != nil {
+			fp.Close()
+			return 0, 0, err
+		}
+		index[key] = &cacheEntry{offset: size, length: e.length, lastRun: e.lastRun}
+		size += int64(e.length)
+		kept++
+	}
+
+	if err := wr.Flush(); err != nil {
+		fp.Close()
+		return 0, 0, err
+	}
+	if err := fp.Sync(); err != nil {
+		fp.Close()
+		return 0, 0, err
+	}
+
+	old := s.data
+	s.gen, s.data, s.size, s.index = gen, fp, size, index
+	// entries keep their last runs, so do not pretend that they were used by this run
+	s.run = s.prevRun
+	if err := s.writeIndexLocked(); err != nil {
+		return 0, 0, err
+	}
+
+	old.Close()
+	s.removeOldSegmentsLocked()
+
+	return kept, dropped, nil
+}
+
+// removeOldSegmentsLocked removes segments of previous generations. Segments that are still open
+// (e.g. on Windows) are removed by the next compaction.
+func (s *cacheStore) removeOldSegmentsLocked() {
+	names, err := filepath.Glob(filepath.Join(s.dir, "cache.*.seg"))
+	if err != nil {
+		return
+	}
+
+	current := filepath.Base(cacheSegmentPath(s.dir, s.gen))
+	for _, name := range names {
+		if filepath.Base(name) != current {
+			os.Remove(name)
+		}
+	}
+}
+
+func (s *cacheStore) close() error {
+	if err := s.flush(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lock.Close()
+	return s.data.Close()
+}
+
+var tmpFileCounter uint32
+
+// writeFileAtomic writes file contents to a temporary file and renames it, so that readers
+// see either old or new contents.
+func writeFileAtomic(filename string, contents []byte) error {
+	// ioutil.TempFile is not used because it ignores umask
+	tmpPath := filename + ".tmp." + strconv.Itoa(os.Getpid()) + "." + strconv.FormatUint(uint64(atomic.AddUint32(&tmpFileCounter, 1)), 10)
+	fp, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fp.Write(contents); err != nil {
+		fp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	// Windows clearly does not want to allow to rename unclosed files
+	if err := fp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := os.Rename(tmpPath, filename); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return nil
+}
+
+// removeLegacyCacheFiles removes "<filename>.<md5>" files that were used for cache before cacheStore
+// and directories that became empty.
+func removeLegacyCacheFiles(dir string) (removed int, err error) {
+	var dirs []string
+
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			if path != dir {
+				dirs = append(dirs, path)
+			}
+			return nil
+		}
+
+		if isLegacyCacheFile(info.Name()) {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			removed++
+		}
+		return nil
+	})
+
+	// remove nested directories first, non-empty ones are left as is
+	for i := len(dirs) - 1; i >= 0; i-- {
+		os.Remove(dirs[i])
+	}
+
+	return removed, err
+}
+
+func isLegacyCacheFile(name string) bool {
+	const hashLen = 32
+
+	if filepath.Ext(name) == ".tmp" {
+		name = name[0 : len(name)-len(".tmp")]
+	}
+
+	if len(name) < hashLen+1 || name[len(name)-hashLen-1] != '.' {
+		return false
+	}
+
+	for _, c := range name[len(name)-hashLen:] {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+
+	return true
+}
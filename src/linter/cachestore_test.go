@@ -0,0 +1,267 @@
+package linter
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func newTestCacheDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "noverify-cache-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func openTestCacheStore(t *testing.T, dir string) *cacheStore {
+	t.Helper()
+
+	s, err := openCacheStore(dir)
+	if err != nil {
+		t.Fatalf("Could not open cache: %v", err)
+	}
+	return s
+}
+
+func checkCacheValue(t *testing.T, s *cacheStore, key, expected string) {
+	t.Helper()
+
+	value, ok := s.get(key)
+	if expected == "" {
+		if ok {
+			t.Errorf("Unexpected value for %s: %q", key, value)
+		}
+		return
+	}
+
+	if !ok {
+		t.Errorf("No value for %s", key)
+	} else if string(value) != expected {
+		t.Errorf("Unexpected value for %s: %q, expected %q", key, value, expected)
+	}
+}
+
+func TestCacheStorePersistence(t *testing.T) {
+	dir := newTestCacheDir(t)
+	defer os.RemoveAll(dir)
+
+	s := openTestCacheStore(t, dir)
+	if err := s.put("a", []byte("first")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.put("b", []byte("second")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.put("a", []byte("replaced")); err != nil {
+		t.Fatal(err)
+	}
+	checkCacheValue(t, s, "a", "replaced")
+	checkCacheValue(t, s, "c", "")
+	if err := s.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s = openTestCacheStore(t, dir)
+	defer s.close()
+	checkCacheValue(t, s, "a", "replaced")
+	checkCacheValue(t, s, "b", "second")
+}
+
+func TestCacheStoreRecovery(t *testing.T) {
+	dir := newTestCacheDir(t)
+	defer os.RemoveAll(dir)
+
+	s := openTestCacheStore(t, dir)
+	s.put("flushed", []byte("1"))
+	s.flush()
+	// process exits without flushing index
+	s.put("not flushed", []byte("2"))
+	s.put("truncated", []byte("3"))
+	s.data.Truncate(s.size - 1)
+	s.data.Close()
+
+	s = openTestCacheStore(t, dir)
+	checkCacheValue(t, s, "flushed", "1")
+	checkCacheValue(t, s, "not flushed", "2")
+	checkCacheValue(t, s, "truncated", "")
+
+	// truncated record is overwritten
+	s.put("new", []byte("4"))
+	s.close()
+
+	s = openTestCacheStore(t, dir)
+	defer s.close()
+	checkCacheValue(t, s, "new", "4")
+}
+
+func TestCacheStoreCorruptedIndex(t *testing.T) {
+	dir := newTestCacheDir(t)
+	defer os.RemoveAll(dir)
+
+	s := openTestCacheStore(t, dir)
+	s.put("a", []byte("1"))
+	s.close()
+
+	if err := ioutil.WriteFile(cacheIndexPath(dir), []byte("garbage"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	// records are scanned again
+	s = openTestCacheStore(t, dir)
+	defer s.close()
+	checkCacheValue(t, s, "a", "1")
+}
+
+func TestCacheStoreCompact(t *testing.T) {
+	cacheDir := newTestCacheDir(t)
+	defer os.RemoveAll(cacheDir)
+
+	namespace, err := cacheNamespace()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(cacheDir, namespace)
+	s := openTestCacheStore(t, dir)
+	s.put("old", []byte("1"))
+	s.put("kept", []byte("2"))
+	s.close()
+
+	// next run only uses one of entries and adds a new one
+	s = openTestCacheStore(t, dir)
+	checkCacheValue(t, s, "kept", "2")
+	s.put("new", []byte("3"))
+	s.close()
+
+	legacy := filepath.Join(cacheDir, "src", "file.php.0123456789abcdef0123456789abcdef")
+	os.MkdirAll(filepath.Dir(legacy), 0777)
+	ioutil.WriteFile(legacy, []byte("legacy"), 0666)
+
+	CacheDir = cacheDir
+	defer func() {
+		CacheDir = ""
+		getMetaCache()
+	}()
+
+	kept, dropped, err := CompactCache()
+	if err != nil {
+		t.Fatalf("Could not compact cache: %v", err)
+	}
+	if kept != 2 || dropped != 2 {
+		t.Errorf("Unexpected compaction result: kept %d, dropped %d", kept, dropped)
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, "src")); !os.IsNotExist(err) {
+		t.Errorf("Legacy cache files were not removed")
+	}
+	if _, err := os.Stat(cacheSegmentPath(dir, 0)); !os.IsNotExist(err) {
+		t.Errorf("Old segment was not removed")
+	}
+
+	// compaction does not count as a run, so the same entries are kept again
+	s = openTestCacheStore(t, dir)
+	checkCacheValue(t, s, "old", "")
+	checkCacheValue(t, s, "kept", "2")
+	checkCacheValue(t, s, "new", "3")
+	s.close()
+}
+
+func TestCacheStoreConcurrentReaders(t *testing.T) {
+	dir := newTestCacheDir(t)
+	defer os.RemoveAll(dir)
+
+	s := openTestCacheStore(t, dir)
+	defer s.close()
+
+	const n = 100
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < n; j++ {
+				key := fmt.Sprintf("key%d", j)
+				if value, ok := s.get(key); ok && string(value) != "value of "+key {
+					t.Errorf("Unexpected value for %s: %q", key, value)
+				}
+			}
+		}()
+	}
+
+	for j := 0; j < n; j++ {
+		key := fmt.Sprintf("key%d", j)
+		if err := s.put(key, []byte("value of "+key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+
+	for j := 0; j < n; j++ {
+		key := fmt.Sprintf("key%d", j)
+		checkCacheValue(t, s, key, "value of "+key)
+	}
+}
+
+func TestCacheNamespace(t *testing.T) {
+	ns, err := cacheNamespace()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(ns, fmt.Sprintf("v%d-", cacheVersion)) {
+		t.Errorf("Namespace %s does not include cache version", ns)
+	}
+
+	defer func(old []RootCheckerCreateFunc) { customRootLinters = old }(customRootLinters)
+	RegisterRootChecker(func(ctx *RootContext) RootChecker { return nil })
+
+	custom, err := cacheNamespace()
+	if err != nil {
+		t.Fatalf("Could not get namespace with custom checker: %v", err)
+	}
+	if custom == ns {
+		t.Errorf("Namespace %s does not depend on custom checkers", ns)
+	}
+
+	// the same build with the same checkers must always use the same namespace
+	if again, _ := cacheNamespace(); again != custom {
+		t.Errorf("Namespace changed from %s to %s", custom, again)
+	}
+}
+
+func TestCacheStoreShared(t *testing.T) {
+	dir := newTestCacheDir(t)
+	defer os.RemoveAll(dir)
+
+	// two processes that use the same cache at the same time
+	s1 := openTestCacheStore(t, dir)
+	s2 := openTestCacheStore(t, dir)
+
+	s1.put("a", []byte("1"))
+	s2.put("b", []byte("2"))
+	s1.put("c", []byte("3"))
+
+	// records appended by other process are found when index is written
+	s2.flush()
+	checkCacheValue(t, s2, "c", "3")
+
+	if _, _, err := s1.compact(); err != nil {
+		t.Fatalf("Could not compact cache: %v", err)
+	}
+
+	// segment was replaced by compaction
+	s2.put("d", []byte("4"))
+	s2.close()
+	s1.close()
+
+	s := openTestCacheStore(t, dir)
+	defer s.close()
+	checkCacheValue(t, s, "a", "1")
+	checkCacheValue(t, s, "b", "2")
+	checkCacheValue(t, s, "c", "3")
+	checkCacheValue(t, s, "d", "4")
+}
@@ -0,0 +1,252 @@
+package linter
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// CheckInfo describes a check (diagnostic name) that linter can report.
+type CheckInfo struct {
+	// Name is the check name that is used in reports, e.g. "undefined".
+	Name string
+
+	// Default is the severity level that check uses by default, e.g. LevelError.
+	Default int
+
+	// Comment is a short description of what check finds.
+	Comment string
+
+	// Before is an example of PHP code that triggers the check.
+	Before string
+
+	// After is the same example fixed so that check is not triggered.
+	After string
+}
+
+var declaredChecks struct {
+	sync.Mutex
+	m map[string]CheckInfo
+}
+
+// DeclareCheck adds check to the list of known checks.
+// Custom checkers should declare all checks they report before cmd.Main() is called,
+// otherwise their check names can not be used in -exclude-checks.
+//
+// DeclareCheck panics if check name is empty or check is already declared.
+func DeclareCheck(info CheckInfo) {
+	if info.Name == "" {
+		panic("check name must not be empty")
+	}
+
+	declaredChecks.Lock()
+	defer declaredChecks.Unlock()
+
+	if declaredChecks.m == nil {
+		declaredChecks.m = make(map[string]CheckInfo)
+	}
+
+	if _, ok := declaredChecks.m[info.Name]; ok {
+		panic(fmt.Sprintf("check %s is already declared", info.Name))
+	}
+
+	declaredChecks.m[info.Name] = info
+}
+
+// GetDeclaredCheck returns info about the declared check.
+func GetDeclaredCheck(name string) (info CheckInfo, ok bool) {
+	declaredChecks.Lock()
+	defer declaredChecks.Unlock()
+
+	info, ok = declaredChecks.m[name]
+	return info, ok
+}
+
+// GetDeclaredChecks returns all declared checks sorted by name.
+func GetDeclaredChecks() []CheckInfo {
+	declaredChecks.Lock()
+	defer declaredChecks.Unlock()
+
+	res := make([]CheckInfo, 0, len(declaredChecks.m))
+	for _, info := range declaredChecks.m {
+		res = append(res, info)
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+
+	return res
+}
+
+func init() {
+	builtinChecks := []CheckInfo{
+		{
+			Name:    "accessLevel",
+			Default: LevelError,
+			Comment: "Report access to private or protected elements from outside of their scope.",
+			Before: `class Foo { private function bar() {} }
+(new Foo)->bar();`,
+			After: `class Foo { public function bar() {} }
+(new Foo)->bar();`,
+		},
+
+		{
+			Name:    "argCount",
+			Default: LevelWarning,
+			Comment: "Report calls with too few arguments.",
+			Before: `function f($a, $b) {}
+f(1);`,
+			After: `function f($a, $b) {}
+f(1, 2);`,
+		},
+
+		{
+			Name:    "arrayAccess",
+			Default: LevelDoNotReject,
+			Comment: "Report array access to objects that do not implement ArrayAccess.",
+			Before: `class Foo {}
+function f(Foo $x) { return $x[0]; }`,
+			After: `function f(array $x) { return $x[0]; }`,
+		},
+
+		{
+			Name:    "arrayKeys",
+			Default: LevelWarning,
+			Comment: "Report duplicate array keys and arrays that mix implicit and explicit keys.",
+			Before:  `$a = ['x' => 1, 'x' => 2];`,
+			After:   `$a = ['x' => 1, 'y' => 2];`,
+		},
+
+		{
+			Name:    "arraySyntax",
+			Default: LevelDoNotReject,
+			Comment: "Report usages of old array() syntax.",
+			Before:  `$a = array(1, 2);`,
+			After:   `$a = [1, 2];`,
+		},
+
+		{
+			Name:    "bareTry",
+			Default: LevelError,
+			Comment: "Report try blocks without catch and finally.",
+			Before: `function f() {}
+try { f(); }`,
+			After: `function f() {}
+try { f(); } finally {}`,
+		},
+
+		{
+			Name:    "caseBreak",
+			Default: LevelInformation,
+			Comment: "Report switch cases that fall through to the next case without a comment.",
+			Before: `function f($x) {
+  switch ($x) {
+  case 1:
+    echo 1;
+  case 2:
+    echo 2;
+  }
+}`,
+			After: `function f($x) {
+  switch ($x) {
+  case 1:
+    echo 1;
+    // fallthrough
+  case 2:
+    echo 2;
+  }
+}`,
+		},
+
+		{
+			Name:    "complexity",
+			Default: LevelDoNotReject,
+			Comment: fmt.Sprintf("Report functions and methods that are longer than %d lines.", maxFunctionLines),
+			Before: `function f() {
+  // more than 150 lines of code
+}`,
+			After: `function f() {
+  g(); // split big function into smaller ones
+}`,
+		},
+
+		{
+			Name:    "deadCode",
+			Default: LevelInformation,
+			Comment: "Report unreachable code.",
+			Before: `function f() {
+  return 1;
+  echo "unreachable";
+}`,
+			After: `function f() {
+  echo "reachable";
+  return 1;
+}`,
+		},
+
+		{
+			Name:    "phpdoc",
+			Default: LevelInformation,
+			Comment: "Report malformed PHPDoc comments.",
+			Before: `/** @param int */
+function f() {}`,
+			After: `/** @param int $x */
+function f($x) {}`,
+		},
+
+		{
+			Name:    "stdInterface",
+			Default: LevelError,
+			Comment: "Report incorrect implementations of standard interfaces.",
+			Before: `class Foo implements IteratorAggregate {
+  /** @return int */
+  public function getIterator() { return 1; }
+}`,
+			After: `class Foo implements IteratorAggregate {
+  /** @return ArrayIterator */
+  public function getIterator() { return new ArrayIterator([]); }
+}`,
+		},
+
+		{
+			Name:    "syntax",
+			Default: LevelError,
+			Comment: "Report syntax errors.",
+			Before:  `function f( {}`,
+			After:   `function f() {}`,
+		},
+
+		{
+			Name:    "undefined",
+			Default: LevelError,
+			Comment: "Report usages of undefined functions, methods, properties, constants, classes and variables.",
+			Before:  `undefined_function();`,
+			After: `function defined_function() {}
+defined_function();`,
+		},
+
+		{
+			Name:    "unused",
+			Default: LevelUnused,
+			Comment: "Report variables that are assigned but never used.",
+			Before: `function f() {
+  $x = 1;
+}`,
+			After: `function f() {
+  $x = 1;
+  return $x;
+}`,
+		},
+
+		{
+			Name:    unusedIgnoreCheckName,
+			Default: LevelWarning,
+			Comment: "Report '" + IgnoreDirective + "' directives that do not suppress any reports.",
+			Before:  `$x = 1; // ` + IgnoreDirective + ` undefined`,
+			After:   `$x = 1;`,
+		},
+	}
+
+	for _, info := range builtinChecks {
+		DeclareCheck(info)
+	}
+}
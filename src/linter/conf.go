@@ -6,6 +6,13 @@ var (
 
 	CacheDir string
 
+	// StubsSnapshot is a file with meta info of StubsDir that is used instead of parsing stubs, see InitStubs.
+	StubsSnapshot string
+
+	// KeepReportsContents makes reports keep analyzed file contents, see Report.FileContents.
+	// It is disabled by default because it keeps contents of all files with reports in memory.
+	KeepReportsContents bool
+
 	// AnalysisFiles is a list of files that are being analyzed (in non-git mode)
 	AnalysisFiles []string
 
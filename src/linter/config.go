@@ -0,0 +1,336 @@
+package linter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ConfigFilenames are the names of project configuration file that are looked up in the project root.
+// Files with ".yml" or ".yaml" extension are YAML, others are JSON.
+var ConfigFilenames = []string{".noverify.yml", ".noverify.json"}
+
+// Config is a project configuration.
+//
+// All paths and globs are relative to the directory that contains config file.
+// Globs support "*" and "?" that do not match "/", "**" that matches any number of directories,
+// and a trailing "/" that matches everything inside a directory.
+type Config struct {
+	// Exclude is a list of globs for files that must not be reported.
+	Exclude []string `json:"exclude" yaml:"exclude"`
+
+	// ExcludeChecks is a list of check names that are disabled everywhere unless enabled in Paths.
+	ExcludeChecks []string `json:"exclude_checks" yaml:"exclude_checks"`
+
+	// AllowDisable is a regexp for filenames where '@linter disable' is allowed.
+	AllowDisable string `json:"allow_disable" yaml:"allow_disable"`
+
+	StubsDir          string   `json:"stubs_dir" yaml:"stubs_dir"`
+	StubsSnapshot     string   `json:"stubs_snapshot" yaml:"stubs_snapshot"`
+	CacheDir          string   `json:"cache_dir" yaml:"cache_dir"`
+	FullAnalysisFiles []string `json:"full_analysis_files" yaml:"full_analysis_files"`
+
+	// Severity maps check names to severity names, e.g. {"caseBreak": "error"}.
+	Severity map[string]string `json:"severity" yaml:"severity"`
+
+	// Paths enable and disable checks or change their severity for certain paths.
+	// When several rules match a file, the last one wins.
+	Paths []PathConfig `json:"paths" yaml:"paths"`
+
+	root          string
+	excludeGlobs  []*regexp.Regexp
+	excludeChecks map[string]bool
+	severity      map[string]int
+	paths         []compiledPathConfig
+}
+
+// PathConfig enables and disables checks and changes their severity for files matching Path glob.
+type PathConfig struct {
+	Path     string            `json:"path" yaml:"path"`
+	Enable   []string          `json:"enable" yaml:"enable"`
+	Disable  []string          `json:"disable" yaml:"disable"`
+	Severity map[string]string `json:"severity" yaml:"severity"`
+}
+
+type compiledPathConfig struct {
+	glob     *regexp.Regexp
+	enable   map[string]bool
+	disable  map[string]bool
+	severity map[string]int
+}
+
+var projectConfig *Config
+
+// SetConfig installs project config that is used for every report.
+// It must be called before analysis is started.
+func SetConfig(cfg *Config) {
+	projectConfig = cfg
+}
+
+// GetConfig returns project config or nil if there is none.
+func GetConfig() *Config {
+	return projectConfig
+}
+
+// NewConfig returns empty config with paths relative to the specified root directory.
+func NewConfig(root string) *Config {
+	return &Config{root: root}
+}
+
+// FindConfig returns path to config file in the specified directory or "" if there is no config there.
+func FindConfig(dir string) string {
+	for _, name := range ConfigFilenames {
+		filename := filepath.Join(dir, name)
+		if _, err := os.Stat(filename); err == nil {
+			return filename
+		}
+	}
+	return ""
+}
+
+// LoadConfig reads and validates config file.
+func LoadConfig(filename string) (*Config, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{}
+
+	if ext := filepath.Ext(filename); ext == ".yml" || ext == ".yaml" {
+		err = yaml.UnmarshalStrict(data, cfg)
+	} else {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(cfg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err.Error())
+	}
+
+	cfg.root, err = filepath.Abs(filepath.Dir(filename))
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.StubsDir = cfg.absPath(cfg.StubsDir)
+	cfg.StubsSnapshot = cfg.absPath(cfg.StubsSnapshot)
+	cfg.CacheDir = cfg.absPath(cfg.CacheDir)
+	for i, f := range cfg.FullAnalysisFiles {
+		cfg.FullAnalysisFiles[i] = cfg.absPath(f)
+	}
+
+	if err := cfg.Compile(); err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err.Error())
+	}
+
+	return cfg, nil
+}
+
+// Compile prepares config for matching. It must be called again after exported fields are changed.
+func (cfg *Config) Compile() error {
+	cfg.excludeGlobs = nil
+	for _, g := range cfg.Exclude {
+		re, err := compileGlob(g)
+		if err != nil {
+			return err
+		}
+		cfg.excludeGlobs = append(cfg.excludeGlobs, re)
+	}
+
+	if err := checkNamesDeclared("exclude_checks", cfg.ExcludeChecks); err != nil {
+		return err
+	}
+	cfg.excludeChecks = stringsSet(cfg.ExcludeChecks)
+
+	var err error
+	cfg.severity, err = compileSeverity("severity", cfg.Severity)
+	if err != nil {
+		return err
+	}
+
+	cfg.paths = nil
+	for i, p := range cfg.Paths {
+		re, err := compileGlob(p.Path)
+		if err != nil {
+			return err
+		}
+		if err := checkNamesDeclared(fmt.Sprintf("paths[%d].enable", i), p.Enable); err != nil {
+			return err
+		}
+		if err := checkNamesDeclared(fmt.Sprintf("paths[%d].disable", i), p.Disable); err != nil {
+			return err
+		}
+		severity, err := compileSeverity(fmt.Sprintf("paths[%d].severity", i), p.Severity)
+		if err != nil {
+			return err
+		}
+		cfg.paths = append(cfg.paths, compiledPathConfig{
+			glob:     re,
+			enable:   stringsSet(p.Enable),
+			disable:  stringsSet(p.Disable),
+			severity: severity,
+		})
+	}
+
+	return nil
+}
+
+// checkNamesDeclared returns an error if some of the names are not declared checks, field is used in the message.
+func checkNamesDeclared(field string, names []string) error {
+	for _, name := range names {
+		if _, ok := GetDeclaredCheck(name); !ok {
+			return fmt.Errorf("unknown check %s in %s, use -list-checks to see all checks", name, field)
+		}
+	}
+	return nil
+}
+
+func compileSeverity(field string, names map[string]string) (map[string]int, error) {
+	res := make(map[string]int, len(names))
+	for checkName, name := range names {
+		if _, ok := GetDeclaredCheck(checkName); !ok {
+			return nil, fmt.Errorf("unknown check %s in %s, use -list-checks to see all checks", checkName, field)
+		}
+		level, ok := ParseSeverity(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown severity '%s' for check %s", name, checkName)
+		}
+		res[checkName] = level
+	}
+	return res, nil
+}
+
+// AddSeverity overrides severity of checkName for files matching pathGlob, or for all files if pathGlob is empty.
+// Added rules take precedence over existing ones. Compile must be called afterwards.
+func (cfg *Config) AddSeverity(checkName, severity, pathGlob string) {
+	if pathGlob == "" {
+		if cfg.Severity == nil {
+			cfg.Severity = make(map[string]string)
+		}
+		cfg.Severity[checkName] = severity
+		return
+	}
+
+	cfg.Paths = append(cfg.Paths, PathConfig{
+		Path:     pathGlob,
+		Severity: map[string]string{checkName: severity},
+	})
+}
+
+// absPath returns path relative to config root as an absolute path.
+func (cfg *Config) absPath(path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(cfg.root, path)
+}
+
+// relPath returns filename relative to config root with "/" as separator.
+func (cfg *Config) relPath(filename string) string {
+	if cfg.root != "" && filepath.IsAbs(filename) {
+		rel, err := filepath.Rel(cfg.root, filename)
+		if err == nil && !strings.HasPrefix(rel, "..") {
+			filename = rel
+		}
+	}
+	return filepath.ToSlash(filename)
+}
+
+// IsCheckEnabled reports whether or not reports of checkName must be shown for the specified file.
+func (cfg *Config) IsCheckEnabled(filename, checkName string) bool {
+	path := cfg.relPath(filename)
+
+	for _, re := range cfg.excludeGlobs {
+		if re.MatchString(path) {
+			return false
+		}
+	}
+
+	enabled := !cfg.excludeChecks[checkName]
+	for _, p := range cfg.paths {
+		if !p.glob.MatchString(path) {
+			continue
+		}
+		if p.disable[checkName] {
+			enabled = false
+		}
+		if p.enable[checkName] {
+			enabled = true
+		}
+	}
+
+	return enabled
+}
+
+// CheckSeverity returns severity level that must be used for the report instead of the default level.
+func (cfg *Config) CheckSeverity(filename, checkName string, level int) int {
+	if l, ok := cfg.severity[checkName]; ok {
+		level = l
+	}
+
+	if len(cfg.paths) == 0 {
+		return level
+	}
+
+	path := cfg.relPath(filename)
+	for _, p := range cfg.paths {
+		if l, ok := p.severity[checkName]; ok && p.glob.MatchString(path) {
+			level = l
+		}
+	}
+
+	return level
+}
+
+func stringsSet(list []string) map[string]bool {
+	res := make(map[string]bool, len(list))
+	for _, s := range list {
+		res[s] = true
+	}
+	return res
+}
+
+// compileGlob converts glob to an anchored regexp.
+func compileGlob(glob string) (*regexp.Regexp, error) {
+	if strings.HasSuffix(glob, "/") {
+		glob += "**"
+	}
+
+	var b strings.Builder
+	b.WriteByte('^')
+	for i := 0; i < len(glob); i++ {
+		switch ch := glob[i]; ch {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				i++
+				if i+1 < len(glob) && glob[i+1] == '/' {
+					i++
+					b.WriteString("(?:.*/)?")
+				} else {
+					b.WriteString(".*")
+				}
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(ch)))
+		}
+	}
+	b.WriteByte('$')
+
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return nil, fmt.Errorf("bad glob '%s': %s", glob, err.Error())
+	}
+	return re, nil
+}
@@ -0,0 +1,197 @@
+package linter
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompileGlob(t *testing.T) {
+	tests := []struct {
+		glob  string
+		path  string
+		match bool
+	}{
+		{"vendor/", "vendor/a.php", true},
+		{"vendor/", "vendor/lib/a.php", true},
+		{"vendor/", "src/vendor/a.php", false},
+		{"*.php", "a.php", true},
+		{"*.php", "src/a.php", false},
+		{"**/*.php", "a.php", true},
+		{"**/*.php", "src/lib/a.php", true},
+		{"src/**/test_?.php", "src/a/b/test_1.php", true},
+		{"src/**/test_?.php", "src/test_12.php", false},
+		{"legacy/**", "legacy/x/y.php", true},
+		{"a.b", "axb", false},
+	}
+
+	for _, tc := range tests {
+		re, err := compileGlob(tc.glob)
+		if err != nil {
+			t.Errorf("compileGlob(%q): %s", tc.glob, err.Error())
+			continue
+		}
+
+		if got := re.MatchString(tc.path); got != tc.match {
+			t.Errorf("glob %q, path %q: expected match=%v, got %v", tc.glob, tc.path, tc.match, got)
+		}
+	}
+}
+
+func TestConfigChecks(t *testing.T) {
+	cfg := &Config{
+		root:          "/project",
+		Exclude:       []string{"vendor/"},
+		ExcludeChecks: []string{"arraySyntax"},
+		Severity:      map[string]string{"caseBreak": "error"},
+		Paths: []PathConfig{
+			{Path: "legacy/", Disable: []string{"undefined"}},
+			{Path: "legacy/new/", Enable: []string{"undefined", "arraySyntax"}},
+		},
+	}
+
+	if err := cfg.Compile(); err != nil {
+		t.Fatalf("Could not compile config: %s", err.Error())
+	}
+
+	tests := []struct {
+		filename  string
+		checkName string
+		enabled   bool
+	}{
+		{"/project/vendor/a.php", "undefined", false},
+		{"/project/src/a.php", "undefined", true},
+		{"/project/src/a.php", "arraySyntax", false},
+		{"/project/legacy/a.php", "undefined", false},
+		{"/project/legacy/new/a.php", "undefined", true},
+		{"/project/legacy/new/a.php", "arraySyntax", true},
+		{"legacy/a.php", "undefined", false},
+	}
+
+	for _, tc := range tests {
+		if got := cfg.IsCheckEnabled(tc.filename, tc.checkName); got != tc.enabled {
+			t.Errorf("%s %s: expected enabled=%v, got %v", tc.filename, tc.checkName, tc.enabled, got)
+		}
+	}
+
+	if level := cfg.CheckSeverity("/project/a.php", "caseBreak", LevelInformation); level != LevelError {
+		t.Errorf("Unexpected caseBreak severity: expected %d, got %d", LevelError, level)
+	}
+	if level := cfg.CheckSeverity("/project/a.php", "deadCode", LevelInformation); level != LevelInformation {
+		t.Errorf("Unexpected deadCode severity: expected %d, got %d", LevelInformation, level)
+	}
+}
+
+func TestConfigPathSeverity(t *testing.T) {
+	cfg := NewConfig("/project")
+	cfg.AddSeverity("caseBreak", "error", "")
+	cfg.AddSeverity("undefined", "maybe", "legacy/")
+	cfg.AddSeverity("undefined", "warning", "legacy/*.inc.php")
+
+	if err := cfg.Compile(); err != nil {
+		t.Fatalf("Could not compile config: %s", err.Error())
+	}
+
+	tests := []struct {
+		filename  string
+		checkName string
+		level     int
+		expected  int
+	}{
+		{"/project/a.php", "caseBreak", LevelInformation, LevelError},
+		{"/project/legacy/a.php", "caseBreak", LevelInformation, LevelError},
+		{"/project/a.php", "undefined", LevelError, LevelError},
+		{"/project/legacy/a.php", "undefined", LevelError, LevelDoNotReject},
+		{"/project/legacy/a.inc.php", "undefined", LevelError, LevelWarning},
+	}
+
+	for _, tc := range tests {
+		if got := cfg.CheckSeverity(tc.filename, tc.checkName, tc.level); got != tc.expected {
+			t.Errorf("%s %s: expected level %d, got %d", tc.filename, tc.checkName, tc.expected, got)
+		}
+	}
+
+	cfg.AddSeverity("unused", "fatal", "")
+	if err := cfg.Compile(); err == nil {
+		t.Errorf("Expected error for unknown severity")
+	}
+}
+
+func TestConfigUnknownChecks(t *testing.T) {
+	tests := []*Config{
+		{ExcludeChecks: []string{"arraysyntax"}},
+		{Severity: map[string]string{"casebreak": "error"}},
+		{Paths: []PathConfig{{Path: "legacy/", Enable: []string{"undefinde"}}}},
+		{Paths: []PathConfig{{Path: "legacy/", Disable: []string{"undefinde"}}}},
+		{Paths: []PathConfig{{Path: "legacy/", Severity: map[string]string{"undefinde": "maybe"}}}},
+	}
+
+	for _, cfg := range tests {
+		err := cfg.Compile()
+		if err == nil || !strings.Contains(err.Error(), "unknown check") {
+			t.Errorf("Expected unknown check error for %+v, got %v", cfg, err)
+		}
+	}
+}
+
+func TestLoadConfigFormats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "noverify-config")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		".noverify.json": `{
+	"stubs_dir": "stubs",
+	"exclude": ["vendor/"],
+	"severity": {"caseBreak": "error"},
+	"paths": [{"path": "legacy/", "disable": ["undefined"]}]
+}`,
+		".noverify.yml": `
+stubs_dir: stubs
+exclude: [vendor/]
+severity:
+  caseBreak: error
+paths:
+  - path: legacy/
+    disable: [undefined]
+`,
+	}
+
+	var loaded []string
+	for name, contents := range files {
+		filename := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(filename, []byte(contents), 0644); err != nil {
+			t.Fatalf("Could not write %s: %v", name, err)
+		}
+
+		cfg, err := LoadConfig(filename)
+		if err != nil {
+			t.Fatalf("Could not load %s: %v", name, err)
+		}
+		if cfg.StubsDir != filepath.Join(dir, "stubs") {
+			t.Errorf("%s: stubs_dir is not resolved against config directory: %s", name, cfg.StubsDir)
+		}
+		loaded = append(loaded, fmt.Sprintf("%+v %+v %+v %+v", cfg.StubsDir, cfg.Exclude, cfg.Severity, cfg.Paths))
+	}
+
+	if loaded[0] != loaded[1] {
+		t.Errorf("YAML and JSON configs differ: %s and %s", loaded[0], loaded[1])
+	}
+
+	if got := FindConfig(dir); got != filepath.Join(dir, ".noverify.yml") {
+		t.Errorf("Expected .noverify.yml to be found first, got %s", got)
+	}
+
+	unknown := filepath.Join(dir, "unknown.yml")
+	if err := ioutil.WriteFile(unknown, []byte("stubs: stubs\n"), 0644); err != nil {
+		t.Fatalf("Could not write %s: %v", unknown, err)
+	}
+	if _, err := LoadConfig(unknown); err == nil {
+		t.Errorf("Unknown field in YAML config is not rejected")
+	}
+}
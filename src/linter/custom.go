@@ -1,6 +1,8 @@
 package linter
 
 import (
+	"strings"
+
 	"github.com/VKCOM/noverify/src/meta"
 	"github.com/VKCOM/noverify/src/vscode"
 	"github.com/z7zmey/php-parser/node"
@@ -68,6 +70,32 @@ func (ctx *RootContext) Report(n node.Node, level int, checkName, msg string, ar
 	ctx.w.Report(n, level, checkName, msg, args...)
 }
 
+// ReportWithFix records linter warning of specified level with an automatic fix.
+// Use ReplaceNodeEdit and other *Edit methods to compute fix edits.
+func (ctx *RootContext) ReportWithFix(n node.Node, level int, checkName string, fix *Fix, msg string, args ...interface{}) {
+	ctx.w.ReportWithFix(n, level, checkName, fix, msg, args...)
+}
+
+// NodeText returns source code of the specified node.
+func (ctx *RootContext) NodeText(n node.Node) string {
+	return ctx.w.NodeText(n)
+}
+
+// ReplaceNodeEdit returns edit that replaces source code of node n with replacement.
+func (ctx *RootContext) ReplaceNodeEdit(n node.Node, replacement string) TextEdit {
+	return ctx.w.ReplaceNodeEdit(n, replacement)
+}
+
+// InsertBeforeNodeEdit returns edit that inserts text right before node n.
+func (ctx *RootContext) InsertBeforeNodeEdit(n node.Node, text string) TextEdit {
+	return ctx.w.InsertBeforeNodeEdit(n, text)
+}
+
+// InsertAfterNodeEdit returns edit that inserts text right after node n.
+func (ctx *RootContext) InsertAfterNodeEdit(n node.Node, text string) TextEdit {
+	return ctx.w.InsertAfterNodeEdit(n, text)
+}
+
 // Scope returns variables declared at root level.
 func (ctx *RootContext) Scope() *meta.Scope {
 	return ctx.w.Scope()
@@ -100,6 +128,32 @@ func (ctx *BlockContext) Report(n node.Node, level int, checkName, msg string, a
 	ctx.w.Report(n, level, checkName, msg, args...)
 }
 
+// ReportWithFix records linter warning of specified level with an automatic fix.
+// Use ReplaceNodeEdit and other *Edit methods to compute fix edits.
+func (ctx *BlockContext) ReportWithFix(n node.Node, level int, checkName string, fix *Fix, msg string, args ...interface{}) {
+	ctx.w.ReportWithFix(n, level, checkName, fix, msg, args...)
+}
+
+// NodeText returns source code of the specified node.
+func (ctx *BlockContext) NodeText(n node.Node) string {
+	return ctx.w.r.NodeText(n)
+}
+
+// ReplaceNodeEdit returns edit that replaces source code of node n with replacement.
+func (ctx *BlockContext) ReplaceNodeEdit(n node.Node, replacement string) TextEdit {
+	return ctx.w.r.ReplaceNodeEdit(n, replacement)
+}
+
+// InsertBeforeNodeEdit returns edit that inserts text right before node n.
+func (ctx *BlockContext) InsertBeforeNodeEdit(n node.Node, text string) TextEdit {
+	return ctx.w.r.InsertBeforeNodeEdit(n, text)
+}
+
+// InsertAfterNodeEdit returns edit that inserts text right after node n.
+func (ctx *BlockContext) InsertAfterNodeEdit(n node.Node, text string) TextEdit {
+	return ctx.w.r.InsertAfterNodeEdit(n, text)
+}
+
 // Scope returns variables declared in this block.
 func (ctx *BlockContext) Scope() *meta.Scope {
 	return ctx.w.Scope()
@@ -165,6 +219,28 @@ var severityNames = map[int]string{
 	LevelSyntax:      "SYNTAX ",
 }
 
+// SeverityName returns human-readable name for the specified severity level, e.g. "ERROR" or "MAYBE".
+func SeverityName(level int) string {
+	return strings.TrimSpace(severityNames[level])
+}
+
+var severityByName = map[string]int{
+	"error":       LevelError,
+	"warning":     LevelWarning,
+	"info":        LevelInformation,
+	"information": LevelInformation,
+	"hint":        LevelHint,
+	"unused":      LevelUnused,
+	"maybe":       LevelDoNotReject,
+	"syntax":      LevelSyntax,
+}
+
+// ParseSeverity returns severity level by its case-insensitive name, e.g. "error" or "maybe".
+func ParseSeverity(name string) (level int, ok bool) {
+	level, ok = severityByName[strings.ToLower(strings.TrimSpace(name))]
+	return level, ok
+}
+
 var (
 	customBlockLinters []BlockCheckerCreateFunc
 	customRootLinters  []RootCheckerCreateFunc
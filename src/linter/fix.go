@@ -0,0 +1,186 @@
+package linter
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	"github.com/VKCOM/noverify/src/vscode"
+	"github.com/z7zmey/php-parser/node"
+)
+
+// TextEdit replaces file contents in byte range [Start, End) with Replacement.
+// Offsets are 0-based and refer to the file contents that were analyzed.
+type TextEdit struct {
+	Start       int
+	End         int
+	Replacement string
+}
+
+// Fix is a set of edits that fixes a single report. Edits of a fix are applied all together or not at all.
+type Fix struct {
+	Title string
+	Edits []TextEdit
+}
+
+// DiagnosticFix is a fix for a language server diagnostic.
+type DiagnosticFix struct {
+	Diagnostic vscode.Diagnostic
+	Fix        *Fix
+}
+
+// NodeText returns source code of the specified node.
+func (d *RootWalker) NodeText(n node.Node) string {
+	start, end, ok := d.nodeRange(n)
+	if !ok {
+		return ""
+	}
+	return string(d.contents[start:end])
+}
+
+// ReplaceNodeEdit returns edit that replaces source code of node n with replacement.
+func (d *RootWalker) ReplaceNodeEdit(n node.Node, replacement string) TextEdit {
+	start, end, _ := d.nodeRange(n)
+	return TextEdit{Start: start, End: end, Replacement: replacement}
+}
+
+// InsertBeforeNodeEdit returns edit that inserts text right before node n.
+func (d *RootWalker) InsertBeforeNodeEdit(n node.Node, text string) TextEdit {
+	start, _, _ := d.nodeRange(n)
+	return TextEdit{Start: start, End: start, Replacement: text}
+}
+
+// InsertAfterNodeEdit returns edit that inserts text right after node n.
+func (d *RootWalker) InsertAfterNodeEdit(n node.Node, text string) TextEdit {
+	_, end, _ := d.nodeRange(n)
+	return TextEdit{Start: end, End: end, Replacement: text}
+}
+
+func (d *RootWalker) nodeRange(n node.Node) (start, end int, ok bool) {
+	// invalid range makes ApplyFixes skip the whole fix
+	pos := d.Positions[n]
+	if pos == nil {
+		return -1, -1, false
+	}
+
+	start, end = pos.StartPos-1, pos.EndPos
+	if start < 0 || end > len(d.contents) || start > end {
+		return -1, -1, false
+	}
+
+	return start, end, true
+}
+
+// arraySyntaxFix converts "array(...)" into "[...]".
+func (d *RootWalker) arraySyntaxFix(n node.Node) *Fix {
+	start, end, ok := d.nodeRange(n)
+	if !ok {
+		return nil
+	}
+
+	src := d.contents[start:end]
+	if len(src) < len("array()") || !bytes.EqualFold(src[:len("array")], []byte("array")) || src[len(src)-1] != ')' {
+		return nil
+	}
+
+	open := bytes.IndexByte(src, '(')
+	if open < 0 || len(bytes.TrimSpace(src[len("array"):open])) != 0 {
+		return nil
+	}
+
+	// only replace "array(" and ")" so that fixes of nested arrays do not overlap
+	return &Fix{
+		Title: "Use short array syntax",
+		Edits: []TextEdit{
+			{Start: start, End: start + open + 1, Replacement: "["},
+			{Start: end - 1, End: end, Replacement: "]"},
+		},
+	}
+}
+
+// fallthroughFix adds "// fallthrough" comment before the next case.
+func (d *RootWalker) fallthroughFix(nextCase node.Node) *Fix {
+	start, _, ok := d.nodeRange(nextCase)
+	if !ok {
+		return nil
+	}
+
+	line := d.Positions[nextCase].StartLine
+	if line < 1 || line > len(d.LinesPositions) {
+		return nil
+	}
+
+	lineStart := d.LinesPositions[line-1]
+	prefix := string(d.contents[lineStart:start])
+	if strings.TrimSpace(prefix) != "" {
+		return &Fix{
+			Title: "Add fallthrough comment",
+			Edits: []TextEdit{{Start: start, End: start, Replacement: "/* fallthrough */ "}},
+		}
+	}
+
+	return &Fix{
+		Title: "Add fallthrough comment",
+		Edits: []TextEdit{{Start: lineStart, End: lineStart, Replacement: prefix + "// fallthrough\n"}},
+	}
+}
+
+// ApplyFixes applies fixes to contents. Fixes that overlap with previously accepted ones are skipped.
+// It returns new contents and the list of fixes that were applied.
+func ApplyFixes(contents []byte, fixes []*Fix) (res []byte, applied []*Fix) {
+	var accepted []TextEdit
+
+	overlaps := func(list []TextEdit, e TextEdit) bool {
+		for _, a := range list {
+			if e.Start < a.End && a.Start < e.End {
+				return true
+			}
+			// two insertions at the same place would have an ambiguous order
+			if e.Start == e.End && a.Start == a.End && e.Start == a.Start {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, f := range fixes {
+		n := len(accepted)
+		ok := true
+		for _, e := range f.Edits {
+			if e.Start < 0 || e.End > len(contents) || e.Start > e.End || overlaps(accepted, e) {
+				ok = false
+				break
+			}
+			accepted = append(accepted, e)
+		}
+
+		if !ok {
+			accepted = accepted[:n]
+			continue
+		}
+
+		applied = append(applied, f)
+	}
+
+	sort.Slice(accepted, func(i, j int) bool {
+		a, b := accepted[i], accepted[j]
+		if a.Start != b.Start {
+			return a.Start < b.Start
+		}
+		// insertion goes before replacement that starts at the same place
+		return a.Start == a.End
+	})
+
+	var buf bytes.Buffer
+	buf.Grow(len(contents))
+
+	pos := 0
+	for _, e := range accepted {
+		buf.Write(contents[pos:e.Start])
+		buf.WriteString(e.Replacement)
+		pos = e.End
+	}
+	buf.Write(contents[pos:])
+
+	return buf.Bytes(), applied
+}
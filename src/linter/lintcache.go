@@ -0,0 +1,163 @@
+package linter
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sync/atomic"
+)
+
+// lintCache keeps reports of analyzed files in cache store, so that files that did not change
+// and whose dependencies did not change are not analyzed again.
+//
+// Entry key consists of file name, contents hash and settings that affect reports, including the build
+// itself, because checks can change without changing cacheVersion. Entry itself
+// has words that make up dependencies of the file (see depsIndex) and fingerprint of these dependencies.
+type lintCache struct {
+	store    *cacheStore
+	deps     *depsIndex
+	settings string
+
+	reused int64
+	total  int64
+}
+
+type lintCacheEntry struct {
+	Deps        []string
+	Fingerprint uint64
+	Reports     []*reportJSON
+}
+
+// newLintCache returns lint cache for the current meta info or nil if reports can not be cached.
+// Meta info must not be changed while lint cache is used.
+func newLintCache() *lintCache {
+	if CacheDir == "" || LangServer {
+		return nil
+	}
+
+	// contents of reports are converted to UTF-8 while parsing, cached reports only can use contents as is
+	if KeepReportsContents && DefaultEncoding == "windows-1251" {
+		return nil
+	}
+
+	store := getMetaCache()
+	if store == nil {
+		return nil
+	}
+
+	id, err := buildID()
+	if err != nil {
+		log.Printf("Could not identify build, not caching reports: %s", err.Error())
+		return nil
+	}
+
+	settings := id + "\x00" + DefaultEncoding
+	if cfg := projectConfig; cfg != nil {
+		// compiled config only has what exported fields say, except the root
+		data, err := json.Marshal(cfg)
+		if err != nil {
+			return nil
+		}
+		settings += fmt.Sprintf("\x00%s\x00%x", cfg.root, md5.Sum(data))
+	}
+
+	return &lintCache{
+		store:    store,
+		deps:     newDepsIndex(),
+		settings: settings,
+	}
+}
+
+// lint returns reports for the file, using cached ones if possible.
+func (c *lintCache) lint(f FileInfo) ([]*Report, error) {
+	atomic.AddInt64(&c.total, 1)
+
+	contents := f.Contents
+	if contents == nil {
+		var err error
+		contents, err = ioutil.ReadFile(f.Filename)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	key := fmt.Sprintf("lint\x00%s\x00%s\x00%x", c.settings, f.Filename, md5.Sum(contents))
+
+	if data, ok := c.store.get(key); ok {
+		if reports, ok := c.restore(data, contents); ok {
+			atomic.AddInt64(&c.reused, 1)
+			return reports, nil
+		}
+	}
+
+	_, w, err := ParseContents(f.Filename, contents, DefaultEncoding, f.LineRanges)
+	if err != nil {
+		return nil, err
+	}
+
+	reports := w.GetReports()
+	if err := c.save(key, contents, reports); err != nil {
+		log.Printf("Could not save reports for %s to cache: %s", f.Filename, err.Error())
+	}
+
+	return reports, nil
+}
+
+func (c *lintCache) save(key string, contents []byte, reports []*Report) error {
+	words := make(map[string]struct{})
+	addWords(words, contents)
+	deps := c.deps.closure(words)
+
+	entry := &lintCacheEntry{
+		Deps:        deps,
+		Fingerprint: c.deps.fingerprint(deps),
+		Reports:     make([]*reportJSON, 0, len(reports)),
+	}
+	for _, r := range reports {
+		j := r.toJSON()
+		j.Contents = nil
+		entry.Reports = append(entry.Reports, j)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte(cacheVersion)
+
+	if err := gob.NewEncoder(&buf).Encode(entry); err != nil {
+		return err
+	}
+
+	return c.store.put(key, buf.Bytes())
+}
+
+// restore returns cached reports if dependencies of the file did not change.
+func (c *lintCache) restore(data, contents []byte) (reports []*Report, ok bool) {
+	rd := bufio.NewReader(bytes.NewReader(data))
+
+	if ver, err := rd.ReadByte(); err != nil || ver != cacheVersion {
+		return nil, false
+	}
+
+	var entry lintCacheEntry
+	if err := gob.NewDecoder(rd).Decode(&entry); err != nil {
+		return nil, false
+	}
+
+	if c.deps.fingerprint(entry.Deps) != entry.Fingerprint {
+		return nil, false
+	}
+
+	for _, j := range entry.Reports {
+		r := j.toReport()
+		if KeepReportsContents {
+			r.contents = contents
+		}
+		reports = append(reports, r)
+	}
+
+	return reports, true
+}
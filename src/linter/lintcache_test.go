@@ -0,0 +1,156 @@
+package linter
+
+import (
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/VKCOM/noverify/src/meta"
+)
+
+// lintFiles indexes files and returns reports of all files in order of their names
+// and the number of files with reports taken from cache.
+func lintFiles(t *testing.T, files map[string]string) (reports []string, reused int64) {
+	t.Helper()
+
+	var filenames []string
+	for filename := range files {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+
+	meta.ResetInfo()
+	for _, filename := range filenames {
+		testParse(t, filename, files[filename])
+	}
+	meta.SetIndexingComplete(true)
+	defer meta.SetIndexingComplete(false)
+
+	lc := newLintCache()
+	for _, filename := range filenames {
+		var list []*Report
+		if lc != nil {
+			var err error
+			list, err = lc.lint(FileInfo{Filename: filename, Contents: []byte(files[filename])})
+			if err != nil {
+				t.Fatalf("Could not lint %s: %v", filename, err)
+			}
+		} else {
+			_, w := testParse(t, filename, files[filename])
+			list = w.GetReports()
+		}
+
+		for _, r := range list {
+			reports = append(reports, r.String())
+		}
+	}
+
+	if lc != nil {
+		reused = lc.reused
+	}
+	return reports, reused
+}
+
+func TestLintCacheDependencies(t *testing.T) {
+	cacheDir := newTestCacheDir(t)
+	defer os.RemoveAll(cacheDir)
+
+	defer func() {
+		CacheDir = ""
+		getMetaCache()
+	}()
+
+	files := map[string]string{
+		"a.php": `<?php
+		function a() {
+			foo();
+			return (new B)->bar()->baz();
+		}`,
+		"b.php": `<?php
+		function foo() {}
+		class B {
+			/** @return C */
+			public function bar() { return new C; }
+		}`,
+		"c.php": `<?php
+		class C {
+			public function baz() {}
+		}`,
+		"d.php": `<?php
+		function d() { return 1; }`,
+	}
+
+	check := func(name string, expectedReused int64) []string {
+		t.Helper()
+
+		CacheDir = ""
+		expected, _ := lintFiles(t, files)
+
+		CacheDir = cacheDir
+		reports, reused := lintFiles(t, files)
+
+		if !reflect.DeepEqual(reports, expected) {
+			t.Errorf("%s: reports differ from reports without cache:\n%q\nexpected:\n%q", name, reports, expected)
+		}
+		if reused != expectedReused {
+			t.Errorf("%s: reports of %d files were reused, expected %d", name, reused, expectedReused)
+		}
+		return reports
+	}
+
+	found := func(reports []string, substr string) bool {
+		for _, r := range reports {
+			if strings.Contains(r, substr) {
+				return true
+			}
+		}
+		return false
+	}
+
+	check("first run", 0)
+	check("nothing changed", 4)
+
+	// method is only referred through return type of B::bar()
+	files["c.php"] = `<?php
+	class C {
+		public function qux() {}
+	}`
+	reports := check("method removed", 2) // b.php and d.php
+	if !found(reports, "Call to undefined method {\\C}->baz()") {
+		t.Errorf("No report about undefined method: %q", reports)
+	}
+
+	defer func(old func() (string, error)) { buildID = old }(buildID)
+	buildID = func() (string, error) { return "other build", nil }
+	check("other build", 0)
+	check("nothing changed in other build", 4)
+
+	files["b.php"] = `<?php
+	class B {
+		/** @return C */
+		public function bar() { return new C; }
+	}`
+	reports = check("function removed", 2) // c.php and d.php
+	if !found(reports, "Call to undefined function foo") {
+		t.Errorf("No report about undefined function: %q", reports)
+	}
+}
+
+func TestAddWords(t *testing.T) {
+	words := make(map[string]struct{})
+	addWords(words, []byte(`\NS\Foo_Bar::$baz->qux2()`))
+
+	expected := map[string]struct{}{"ns": {}, "foo_bar": {}, "baz": {}, "qux2": {}}
+	if !reflect.DeepEqual(words, expected) {
+		t.Errorf("Unexpected words %v, expected %v", words, expected)
+	}
+
+	words = make(map[string]struct{})
+	addWords(words, []byte("Ф\xd1\x84x"))
+	expected = map[string]struct{}{"x": {}, "": {}}
+	if !reflect.DeepEqual(words, expected) {
+		t.Errorf("Unexpected words %v, expected %v", words, expected)
+	}
+}
@@ -0,0 +1,481 @@
+package linter
+
+import (
+	"encoding/binary"
+	"hash"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/VKCOM/noverify/src/meta"
+)
+
+// depsIndex finds meta entries that analysis of a file can depend on.
+//
+// Entries (classes, traits, functions, constants, overrides and global variables) are grouped by words
+// of their names without namespace. Every name that is resolved while analyzing a file either comes from
+// the file itself or from types, parents, interfaces and traits of other resolved entries. So words of
+// the file together with words referred by entries of their groups, recursively, cover all entries that
+// the file depends on, including names that were not resolved: declaring such name changes its group.
+//
+// Class members are also looked up by names that come from the file or from types, so a member is only
+// taken into account when words of its name are among the words (magic methods always are).
+//
+// Positions of entries are not part of the fingerprint, reports never refer to them.
+type depsIndex struct {
+	entries map[string][]depsEntry
+
+	mu     sync.Mutex
+	groups map[string]*depsGroup
+}
+
+type depsEntry struct {
+	kind byte
+	name string
+}
+
+const (
+	depsClass byte = iota
+	depsTrait
+	depsFunction
+	depsFunctionOverride
+	depsConstant
+	depsInternalFunction
+	depsInternalFunctionOverride
+	depsGlobal
+)
+
+// depsGroup is a hash of entries with the same word in their names and words of names they refer to.
+type depsGroup struct {
+	depsPart
+	members     map[string]*depsPart // class members of the group, by words of their names
+	memberWords []string             // sorted keys of members
+}
+
+type depsPart struct {
+	hash  uint64
+	words []string
+}
+
+var emptyDepsGroup = &depsGroup{}
+
+func newDepsIndex() *depsIndex {
+	idx := &depsIndex{
+		entries: make(map[string][]depsEntry),
+		groups:  make(map[string]*depsGroup),
+	}
+
+	add := func(kind byte, name string) {
+		words := make(map[string]struct{}, 1)
+		addWords(words, []byte(name[strings.LastIndexByte(name, '\\')+1:]))
+		for w := range words {
+			idx.entries[w] = append(idx.entries[w], depsEntry{kind: kind, name: name})
+		}
+	}
+
+	meta.Info.Lock()
+	defer meta.Info.Unlock()
+
+	for name := range meta.Info.AllClassesNonLocked() {
+		add(depsClass, name)
+	}
+	for name := range meta.Info.AllTraitsNonLocked() {
+		add(depsTrait, name)
+	}
+	for name := range meta.Info.AllFunctionsNonLocked() {
+		add(depsFunction, name)
+	}
+	for name := range meta.Info.AllFunctionsOverridesNonLocked() {
+		add(depsFunctionOverride, name)
+	}
+	for name := range meta.Info.AllConstantsNonLocked() {
+		add(depsConstant, name)
+	}
+	for name := range meta.InternalFunctions() {
+		add(depsInternalFunction, name)
+	}
+	for name := range meta.InternalFunctionOverrides() {
+		add(depsInternalFunctionOverride, name)
+	}
+	meta.Info.Iterate(func(name string, typ *meta.TypesMap, alwaysDefined bool) {
+		add(depsGlobal, name)
+	})
+
+	return idx
+}
+
+// closure adds words that are referred by entries of the groups of words, recursively, and returns all of them sorted.
+func (idx *depsIndex) closure(words map[string]struct{}) []string {
+	queue := make([]string, 0, len(words))
+	for w := range words {
+		queue = append(queue, w)
+	}
+
+	add := func(list []string) {
+		for _, w := range list {
+			if _, ok := words[w]; !ok {
+				words[w] = struct{}{}
+				queue = append(queue, w)
+			}
+		}
+	}
+
+	// members whose names are not among the words yet
+	pending := make(map[string][]*depsPart)
+
+	for i := 0; i < len(queue); i++ {
+		for _, p := range pending[queue[i]] {
+			add(p.words)
+		}
+		delete(pending, queue[i])
+
+		g := idx.group(queue[i])
+		add(g.words)
+		for member, p := range g.members {
+			if _, ok := words[member]; ok {
+				add(p.words)
+			} else {
+				pending[member] = append(pending[member], p)
+			}
+		}
+	}
+
+	sort.Strings(queue)
+	return queue
+}
+
+// fingerprint returns hash of entries in groups of the sorted words.
+func (idx *depsIndex) fingerprint(words []string) uint64 {
+	h := fnv.New64a()
+	var buf [8]byte
+
+	writeHash := func(name string, hash uint64) {
+		h.Write([]byte(name))
+		binary.LittleEndian.PutUint64(buf[:], hash)
+		h.Write(buf[:])
+	}
+
+	for _, w := range words {
+		g := idx.group(w)
+		writeHash(w, g.hash)
+
+		for _, member := range g.memberWords {
+			i := sort.SearchStrings(words, member)
+			if i < len(words) && words[i] == member {
+				writeHash(member, g.members[member].hash)
+			}
+		}
+	}
+
+	return h.Sum64()
+}
+
+func (idx *depsIndex) group(word string) *depsGroup {
+	entries := idx.entries[word]
+	if len(entries) == 0 {
+		return emptyDepsGroup
+	}
+
+	idx.mu.Lock()
+	g, ok := idx.groups[word]
+	idx.mu.Unlock()
+	if ok {
+		return g
+	}
+
+	g = hashDepsGroup(append([]depsEntry(nil), entries...))
+
+	idx.mu.Lock()
+	idx.groups[word] = g
+	idx.mu.Unlock()
+
+	return g
+}
+
+func hashDepsGroup(entries []depsEntry) *depsGroup {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].kind != entries[j].kind {
+			return entries[i].kind < entries[j].kind
+		}
+		return entries[i].name < entries[j].name
+	})
+
+	d := &depsHasher{members: make(map[string]*depsHasher)}
+	d.init()
+
+	for _, e := range entries {
+		d.int(int64(e.kind))
+		d.str(e.name)
+
+		switch e.kind {
+		case depsClass:
+			class, _ := meta.Info.GetClass(e.name)
+			d.class(e.name, class)
+		case depsTrait:
+			class, _ := meta.Info.GetTrait(e.name)
+			d.class(e.name, class)
+		case depsFunction:
+			fn, _ := meta.Info.GetFunction(e.name)
+			d.fn(fn)
+		case depsFunctionOverride:
+			override, _ := meta.Info.GetFunctionOverride(e.name)
+			d.override(override)
+		case depsConstant:
+			c, _ := meta.Info.GetConstant(e.name)
+			d.constant(c)
+		case depsInternalFunction:
+			fn, _ := meta.GetInternalFunctionInfo(e.name)
+			d.fn(fn)
+		case depsInternalFunctionOverride:
+			override, _ := meta.GetInternalFunctionOverrideInfo(e.name)
+			d.override(override)
+		case depsGlobal:
+			typ, _ := meta.Info.GetVarNameType(e.name)
+			d.typ(typ)
+		}
+	}
+
+	g := &depsGroup{
+		depsPart:    d.part(),
+		members:     make(map[string]*depsPart, len(d.members)),
+		memberWords: make([]string, 0, len(d.members)),
+	}
+	for w, m := range d.members {
+		p := m.part()
+		g.members[w] = &p
+		g.memberWords = append(g.memberWords, w)
+	}
+	sort.Strings(g.memberWords)
+
+	return g
+}
+
+// depsHasher writes meta entries to hash and collects words of names they refer to.
+type depsHasher struct {
+	h       hash.Hash64
+	words   map[string]struct{}
+	members map[string]*depsHasher
+	buf     [binary.MaxVarintLen64]byte
+}
+
+func (d *depsHasher) init() {
+	d.h = fnv.New64a()
+	d.words = make(map[string]struct{})
+}
+
+func (d *depsHasher) part() depsPart {
+	p := depsPart{hash: d.h.Sum64(), words: make([]string, 0, len(d.words))}
+	for w := range d.words {
+		p.words = append(p.words, w)
+	}
+	return p
+}
+
+func (d *depsHasher) int(v int64) {
+	d.h.Write(d.buf[:binary.PutVarint(d.buf[:], v)])
+}
+
+func (d *depsHasher) str(s string) {
+	d.int(int64(len(s)))
+	d.h.Write([]byte(s))
+}
+
+// name writes name of an entry that is resolved by the linter.
+func (d *depsHasher) name(s string) {
+	d.str(s)
+	addWords(d.words, []byte(s))
+}
+
+func (d *depsHasher) set(m map[string]struct{}) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	d.int(int64(len(keys)))
+	for _, k := range keys {
+		d.name(k)
+	}
+}
+
+func (d *depsHasher) typ(m *meta.TypesMap) {
+	d.int(int64(m.Len()))
+	m.Iterate(func(t string) {
+		d.str(t)
+		d.typeWords(t)
+	})
+}
+
+// typeWords adds words of the names that are resolved for the (possibly lazy) type.
+func (d *depsHasher) typeWords(t string) {
+	if len(t) == 0 || t[0] >= meta.WMax {
+		addWords(d.words, []byte(t))
+		return
+	}
+
+	switch t[0] {
+	case meta.WGlobal:
+		addWords(d.words, []byte(meta.UnwrapGlobal(t)))
+	case meta.WConstant:
+		addWords(d.words, []byte(meta.UnwrapConstant(t)))
+	case meta.WFunctionCall:
+		addWords(d.words, []byte(meta.UnwrapFunctionCall(t)))
+	case meta.WArrayOf:
+		d.typeWords(meta.UnwrapArrayOf(t))
+	case meta.WElemOf:
+		d.typeWords(meta.UnwrapElemOf(t))
+	case meta.WInstanceMethodCall:
+		expr, methodName := meta.UnwrapInstanceMethodCall(t)
+		d.typeWords(expr)
+		addWords(d.words, []byte(methodName))
+	case meta.WInstancePropertyFetch:
+		expr, propertyName := meta.UnwrapInstancePropertyFetch(t)
+		d.typeWords(expr)
+		addWords(d.words, []byte(propertyName))
+	case meta.WStaticMethodCall:
+		className, methodName := meta.UnwrapStaticMethodCall(t)
+		addWords(d.words, []byte(className))
+		addWords(d.words, []byte(methodName))
+	case meta.WStaticPropertyFetch:
+		className, propertyName := meta.UnwrapStaticPropertyFetch(t)
+		addWords(d.words, []byte(className))
+		addWords(d.words, []byte(propertyName))
+	}
+}
+
+func (d *depsHasher) fn(fn meta.FuncInfo) {
+	d.str(fn.Pos.Filename)
+	d.int(int64(len(fn.Params)))
+	for _, p := range fn.Params {
+		if p.IsRef {
+			d.int(1)
+		} else {
+			d.int(0)
+		}
+		d.str(p.Name)
+		d.typ(p.Typ)
+	}
+	d.int(int64(fn.MinParamsCnt))
+	d.typ(fn.Typ)
+	d.int(int64(fn.AccessLevel))
+	d.int(int64(fn.ExitFlags))
+}
+
+func (d *depsHasher) override(o meta.FuncInfoOverride) {
+	d.int(int64(o.OverrideType))
+	d.int(int64(o.ArgNum))
+}
+
+func (d *depsHasher) constant(c meta.ConstantInfo) {
+	d.str(c.Pos.Filename)
+	d.typ(c.Typ)
+	d.int(int64(c.AccessLevel))
+}
+
+func (d *depsHasher) class(className string, c meta.ClassInfo) {
+	d.str(c.Pos.Filename)
+	d.name(c.Parent)
+	d.int(int64(len(c.ParentInterfaces)))
+	for _, iface := range c.ParentInterfaces {
+		d.name(iface)
+	}
+	d.set(c.Traits)
+	d.set(c.Interfaces)
+
+	methods := make([]string, 0, len(c.Methods))
+	for name := range c.Methods {
+		methods = append(methods, name)
+	}
+	sort.Strings(methods)
+	for _, name := range methods {
+		fn := c.Methods[name]
+		d.member(className, name, func(m *depsHasher) { m.fn(fn) })
+	}
+
+	props := make([]string, 0, len(c.Properties))
+	for name := range c.Properties {
+		props = append(props, name)
+	}
+	sort.Strings(props)
+	for _, name := range props {
+		p := c.Properties[name]
+		d.member(className, name, func(m *depsHasher) {
+			m.typ(p.Typ)
+			m.int(int64(p.AccessLevel))
+		})
+	}
+
+	consts := make([]string, 0, len(c.Constants))
+	for name := range c.Constants {
+		consts = append(consts, name)
+	}
+	sort.Strings(consts)
+	for _, name := range consts {
+		c := c.Constants[name]
+		d.member(className, name, func(m *depsHasher) { m.constant(c) })
+	}
+}
+
+// member writes class member using hashMember to the hasher of every word of its name.
+// Magic methods are called implicitly, so they are written to the class itself.
+func (d *depsHasher) member(className, name string, hashMember func(m *depsHasher)) {
+	if strings.HasPrefix(name, "__") {
+		d.str(name)
+		hashMember(d)
+		return
+	}
+
+	words := make(map[string]struct{}, 1)
+	addWords(words, []byte(name))
+	for w := range words {
+		m := d.members[w]
+		if m == nil {
+			m = &depsHasher{}
+			m.init()
+			d.members[w] = m
+		}
+
+		m.str(className)
+		m.str(name)
+		hashMember(m)
+	}
+}
+
+// addWords adds lowercase words (sequences of ASCII letters, digits and underscores) of s to words.
+// Names with other characters can not be split reliably (e.g. they are in other encoding), so if there are
+// any such characters, an empty word is added too.
+func addWords(words map[string]struct{}, s []byte) {
+	var word []byte
+	nonASCII := false
+
+	flush := func() {
+		if len(word) == 0 {
+			return
+		}
+		if _, ok := words[string(word)]; !ok {
+			words[string(word)] = struct{}{}
+		}
+		word = word[:0]
+	}
+
+	for _, c := range s {
+		switch {
+		case c >= 'A' && c <= 'Z':
+			word = append(word, c+'a'-'A')
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '_':
+			word = append(word, c)
+		default:
+			if c >= 0x80 {
+				nonASCII = true
+			}
+			flush()
+		}
+	}
+	flush()
+
+	if nonASCII {
+		words[""] = struct{}{}
+	}
+}
@@ -124,6 +124,10 @@ func analyzeFile(filename string, contents []byte, parser *php7.Parser, lineRang
 		w.Report(nil, LevelError, "syntax", "Syntax error: "+e.String())
 	}
 
+	if meta.IsIndexingComplete() {
+		w.ReportUnusedSuppressions()
+	}
+
 	atomic.AddInt64(&initWalkTime, int64(time.Since(start)))
 
 	return rootNode, w, nil
@@ -211,6 +215,8 @@ func ReadFilenames(filenames []string, ignoreRegex *regexp.Regexp) ReadCallback
 // ReadChangesFromWorkTree returns callback that reads files from workTree dir that are changed
 func ReadChangesFromWorkTree(dir string, changes []git.Change) ReadCallback {
 	return func(ch chan FileInfo) {
+		deleteMetaForRemovedFiles(changes)
+
 		for _, c := range changes {
 			if c.Type == git.Deleted {
 				continue
@@ -235,6 +241,40 @@ func ReadChangesFromWorkTree(dir string, changes []git.Change) ReadCallback {
 	}
 }
 
+// ReadChangesFromIndex parses new versions of changed files that are staged for commit
+func ReadChangesFromIndex(repo string, changes []git.Change) ReadCallback {
+	catter, err := git.NewCatter(repo)
+	if err != nil {
+		log.Fatalf("Could not start catter: %s", err.Error())
+	}
+
+	return func(ch chan FileInfo) {
+		deleteMetaForRemovedFiles(changes)
+
+		for _, c := range changes {
+			if c.Type == git.Deleted {
+				continue
+			}
+
+			if !strings.HasSuffix(c.NewName, ".php") {
+				continue
+			}
+
+			// ":<filename>" is the blob that is staged in the index
+			obj, err := catter.Get(":" + c.NewName)
+			if err != nil {
+				log.Fatalf("Could not read staged file %s: %s", c.NewName, err.Error())
+			}
+
+			ch <- FileInfo{
+				Filename:   c.NewName,
+				Contents:   obj.Contents,
+				LineRanges: c.LineRanges,
+			}
+		}
+	}
+}
+
 // ReadFilesFromGit parses file contents in the specified commit
 func ReadFilesFromGit(repo, commitSHA1 string, ignoreRegex *regexp.Regexp) ReadCallback {
 	catter, err := git.NewCatter(repo)
@@ -250,16 +290,19 @@ func ReadFilesFromGit(repo, commitSHA1 string, ignoreRegex *regexp.Regexp) ReadC
 	dotPHPBytes := []byte(".php")
 
 	return func(ch chan FileInfo) {
+		var mu sync.Mutex
 		start := time.Now()
 		idx := 0
 
-		err = catter.Walk(
+		err = catter.WalkParallel(
 			"",
 			tree,
+			MaxConcurrency,
 			func(filename []byte) bool {
 				return bytes.HasSuffix(filename, dotPHPBytes)
 			},
 			func(filename string, contents []byte) {
+				mu.Lock()
 				idx++
 				if time.Since(start) >= 2*time.Second {
 					start = time.Now()
@@ -269,6 +312,7 @@ func ReadFilesFromGit(repo, commitSHA1 string, ignoreRegex *regexp.Regexp) ReadC
 					}
 					log.Printf("%s %d files from git", action, idx)
 				}
+				mu.Unlock()
 
 				if ignoreRegex != nil && ignoreRegex.MatchString(filename) {
 					return
@@ -287,7 +331,8 @@ func ReadFilesFromGit(repo, commitSHA1 string, ignoreRegex *regexp.Regexp) ReadC
 	}
 }
 
-// ReadOldFilesFromGit parses file contents in the specified commit, the old version
+// ReadOldFilesFromGit parses file contents in the specified commit, the old version.
+// Definitions from removed files are kept, so that old versions do not report their usages.
 func ReadOldFilesFromGit(repo, commitSHA1 string, changes []git.Change) ReadCallback {
 	changedMap := make(map[string][]git.LineRange, len(changes))
 	for _, ch := range changes {
@@ -310,9 +355,10 @@ func ReadOldFilesFromGit(repo, commitSHA1 string, changes []git.Change) ReadCall
 	dotPHPBytes := []byte(".php")
 
 	return func(ch chan FileInfo) {
-		err = catter.Walk(
+		err = catter.WalkParallel(
 			"",
 			tree,
+			MaxConcurrency,
 			func(filename []byte) bool {
 				if !bytes.HasSuffix(filename, dotPHPBytes) {
 					return false
@@ -336,12 +382,24 @@ func ReadOldFilesFromGit(repo, commitSHA1 string, changes []git.Change) ReadCall
 	}
 }
 
+// deleteMetaForRemovedFiles removes definitions from files that were deleted or renamed,
+// so that usages of these definitions are reported.
+func deleteMetaForRemovedFiles(changes []git.Change) {
+	meta.Info.Lock()
+	defer meta.Info.Unlock()
+
+	for _, c := range changes {
+		if c.Type == git.Deleted || (c.Type == git.Changed && c.OldName != c.NewName) {
+			meta.Info.DeleteMetaForFileNonLocked(c.OldName)
+		}
+	}
+}
+
 // ReadFilesFromGitWithChanges parses file contents in the specified commit, but only specified ranges
 func ReadFilesFromGitWithChanges(repo, commitSHA1 string, changes []git.Change) ReadCallback {
 	changedMap := make(map[string][]git.LineRange, len(changes))
 	for _, ch := range changes {
 		if ch.Type == git.Deleted {
-			// TODO: actually support deletes too
 			continue
 		}
 
@@ -361,9 +419,12 @@ func ReadFilesFromGitWithChanges(repo, commitSHA1 string, changes []git.Change)
 	dotPHPBytes := []byte(".php")
 
 	return func(ch chan FileInfo) {
-		err = catter.Walk(
+		deleteMetaForRemovedFiles(changes)
+
+		err = catter.WalkParallel(
 			"",
 			tree,
+			MaxConcurrency,
 			func(filename []byte) bool {
 				if !bytes.HasSuffix(filename, dotPHPBytes) {
 					return false
@@ -401,6 +462,11 @@ func ParseFilenames(readFileNamesFunc ReadCallback) []*Report {
 
 	needReports := meta.IsIndexingComplete()
 
+	var lc *lintCache
+	if needReports {
+		lc = newLintCache()
+	}
+
 	lintdebug.Send("Parsing using %d cores", MaxConcurrency)
 
 	filenamesCh := make(chan FileInfo)
@@ -418,7 +484,7 @@ func ParseFilenames(readFileNamesFunc ReadCallback) []*Report {
 		go func() {
 			var rep []*Report
 			for f := range filenamesCh {
-				rep = append(rep, doParseFile(f, needReports)...)
+				rep = append(rep, doParseFile(f, needReports, lc)...)
 			}
 			reportsCh <- rep
 			wg.Done()
@@ -431,13 +497,26 @@ func ParseFilenames(readFileNamesFunc ReadCallback) []*Report {
 		allReports = append(allReports, (<-reportsCh)...)
 	}
 
+	if lc != nil {
+		lintdebug.Send("Reused cached reports for %d of %d files", lc.reused, lc.total)
+	}
+
+	if !needReports || lc != nil {
+		if err := FlushCache(); err != nil {
+			log.Printf("Could not flush cache: %s", err.Error())
+		}
+	}
+
 	return allReports
 }
 
-func doParseFile(f FileInfo, needReports bool) (reports []*Report) {
+// doParseFile indexes or analyzes the file. Reports are taken from lc if it is not nil.
+func doParseFile(f FileInfo, needReports bool, lc *lintCache) (reports []*Report) {
 	var err error
 
-	if needReports {
+	if lc != nil {
+		reports, err = lc.lint(f)
+	} else if needReports {
 		var w *RootWalker
 		_, w, err = ParseContents(f.Filename, f.Contents, DefaultEncoding, f.LineRanges)
 		if err == nil {
@@ -454,9 +533,3 @@ func doParseFile(f FileInfo, needReports bool) (reports []*Report) {
 
 	return reports
 }
-
-// InitStubs parses directory with PHPStorm stubs which has all internal PHP classes and functions declared.
-func InitStubs() {
-	ParseFilenames(ReadFilenames([]string{StubsDir}, nil))
-	meta.Info.InitStubs()
-}
@@ -1,6 +1,8 @@
 package linter
 
 import (
+	"bytes"
+	"hash/fnv"
 	"sort"
 	"strings"
 	"sync"
@@ -14,13 +16,18 @@ const (
 )
 
 // DiffReports returns only reports that are new.
+// Reports are matched by line numbers using diff hunks first. Reports in changed lines are then matched
+// by check name, message and surrounding source code, so that problems in moved code are not reported as new.
 // Pass diffArgs=nil if we are called from diff in working copy.
+// Returned reports are attributed to the commits from changeLog that changed reported lines, see Report.Commit().
 func DiffReports(gitRepo string, diffArgs []string, changesList []git.Change, changeLog []git.Commit, oldList, newList []*Report, maxConcurrency int) (res []*Report, err error) {
 	ignoreCommits := make(map[string]struct{})
-	for _, c := range changeLog {
+	commits := make(map[string]*git.Commit, len(changeLog))
+	for i, c := range changeLog {
 		if strings.Contains(c.Message, IgnoreLinterMessage) {
 			ignoreCommits[c.Hash] = struct{}{}
 		}
+		commits[c.Hash] = &changeLog[i]
 	}
 
 	old := reportListToMap(oldList)
@@ -50,7 +57,7 @@ func DiffReports(gitRepo string, diffArgs []string, changesList []git.Change, ch
 				oldName = filename // full diff mode
 			}
 
-			reports, err := diffReportsList(gitRepo, ignoreCommits, diffArgs, filename, c, old[oldName], list)
+			reports, err := diffReportsList(gitRepo, ignoreCommits, commits, diffArgs, filename, c, old[oldName], list)
 			if err != nil {
 				mu.Lock()
 				resErr = err
@@ -70,7 +77,120 @@ func DiffReports(gitRepo string, diffArgs []string, changesList []git.Change, ch
 		return nil, err
 	}
 
-	return res, nil
+	return filterMovedReports(res, oldList, newList), nil
+}
+
+// reportKey identifies report regardless of its position in file.
+type reportKey struct {
+	checkName   string
+	msg         string
+	contextHash uint64
+}
+
+func (r *Report) key() reportKey {
+	return reportKey{checkName: r.checkName, msg: r.msg, contextHash: r.contextHash}
+}
+
+// filterMovedReports removes reports from candidates that were not matched by line numbers, but have
+// the same key as old reports, e.g. when function was moved within a file or to another file.
+// If there are more new reports with the same key than old ones, the rest of candidates are kept.
+func filterMovedReports(candidates, oldList, newList []*Report) []*Report {
+	// number of reports with the same key that were added
+	added := make(map[reportKey]int)
+	for _, r := range newList {
+		added[r.key()]++
+	}
+	for _, r := range oldList {
+		added[r.key()]--
+	}
+
+	byKey := make(map[reportKey][]*Report)
+	for _, r := range candidates {
+		if r.contextHash == 0 {
+			continue
+		}
+		k := r.key()
+		byKey[k] = append(byKey[k], r)
+	}
+
+	moved := make(map[*Report]bool)
+	for k, list := range byKey {
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].filename != list[j].filename {
+				return list[i].filename < list[j].filename
+			}
+			return list[i].startLine < list[j].startLine
+		})
+
+		keep := added[k]
+		if keep < 0 {
+			keep = 0
+		}
+		for i := keep; i < len(list); i++ {
+			moved[list[i]] = true
+		}
+	}
+
+	if len(moved) == 0 {
+		return candidates
+	}
+
+	res := make([]*Report, 0, len(candidates)-len(moved))
+	for _, r := range candidates {
+		if !moved[r] {
+			res = append(res, r)
+		}
+	}
+	return res
+}
+
+// reportContextLines is the maximum number of reported lines that are used to compute report context hash.
+const reportContextLines = 5
+
+// reportContextHash computes hash of the source code around the report: reported lines and nearest
+// non-empty lines before and after them. Whitespace is ignored, so reindented code has the same hash.
+// Zero is returned if position is unknown.
+func reportContextHash(lines [][]byte, startLine, endLine int) uint64 {
+	if startLine < 1 || startLine > len(lines) {
+		return 0
+	}
+	if endLine < startLine {
+		endLine = startLine
+	}
+	if endLine > len(lines) {
+		endLine = len(lines)
+	}
+	if endLine-startLine >= reportContextLines {
+		endLine = startLine + reportContextLines - 1
+	}
+
+	h := fnv.New64a()
+	writeLine := func(ln []byte) {
+		for _, f := range bytes.Fields(ln) {
+			h.Write(f)
+		}
+		h.Write([]byte{'\n'})
+	}
+
+	for i := startLine - 2; i >= 0; i-- {
+		if len(bytes.TrimSpace(lines[i])) > 0 {
+			writeLine(lines[i])
+			break
+		}
+	}
+
+	for i := startLine - 1; i < endLine; i++ {
+		writeLine(lines[i])
+	}
+
+	for i := endLine; i < len(lines); i++ {
+		if len(bytes.TrimSpace(lines[i])) > 0 {
+			writeLine(lines[i])
+			break
+		}
+	}
+
+	return h.Sum64()
 }
 
 type lineRangeChange struct {
@@ -96,7 +216,7 @@ func fmtReports(list []*Report) []byte {
 	return []byte(strings.Join(reports, "\n") + "\n")
 }
 
-func diffReportsList(gitRepo string, ignoreCommits map[string]struct{}, diffArgs []string, filename string, c git.Change, oldList, newList []*Report) (res []*Report, err error) {
+func diffReportsList(gitRepo string, ignoreCommits map[string]struct{}, commits map[string]*git.Commit, diffArgs []string, filename string, c git.Change, oldList, newList []*Report) (res []*Report, err error) {
 	var blame git.BlameResult
 
 	if c.Valid {
@@ -136,13 +256,13 @@ func diffReportsList(gitRepo string, ignoreCommits map[string]struct{}, diffArgs
 			continue
 		}
 
-		res = maybeAppendReports(res, new, old, newLine, oldLine, blame, ignoreCommits)
+		res = maybeAppendReports(res, new, old, newLine, oldLine, blame, ignoreCommits, commits)
 
 		if ok {
 			oldLine = 0 // all changes and additions must be checked
 			for j := newLine + 1; j <= ch.new.To; j++ {
 				newLine = j
-				res = maybeAppendReports(res, new, old, newLine, oldLine, blame, ignoreCommits)
+				res = maybeAppendReports(res, new, old, newLine, oldLine, blame, ignoreCommits, commits)
 			}
 			oldLine = ch.old.To
 		}
@@ -151,7 +271,7 @@ func diffReportsList(gitRepo string, ignoreCommits map[string]struct{}, diffArgs
 	return res, nil
 }
 
-func maybeAppendReports(res []*Report, new, old map[int][]*Report, newLine, oldLine int, blame git.BlameResult, ignoreCommits map[string]struct{}) []*Report {
+func maybeAppendReports(res []*Report, new, old map[int][]*Report, newLine, oldLine int, blame git.BlameResult, ignoreCommits map[string]struct{}, commits map[string]*git.Commit) []*Report {
 	newReports, ok := new[newLine]
 
 	if !ok {
@@ -168,6 +288,16 @@ func maybeAppendReports(res []*Report, new, old map[int][]*Report, newLine, oldL
 		return res
 	}
 
+	if changedCommit != "" {
+		commit, ok := commits[changedCommit]
+		if !ok {
+			commit = &git.Commit{Hash: changedCommit}
+		}
+		for _, r := range newReports {
+			r.commit = commit
+		}
+	}
+
 	return append(res, newReports...)
 }
 
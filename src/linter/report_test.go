@@ -0,0 +1,303 @@
+package linter
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/VKCOM/noverify/src/git"
+	"github.com/VKCOM/noverify/src/meta"
+)
+
+// getReportsForFiles indexes and lints files together, filenames are sorted for stable meta.
+func getReportsForFiles(t *testing.T, files map[string]string) []*Report {
+	var filenames []string
+	for filename := range files {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+
+	meta.ResetInfo()
+	for _, filename := range filenames {
+		testParse(t, filename, files[filename])
+	}
+	meta.SetIndexingComplete(true)
+
+	var res []*Report
+	for _, filename := range filenames {
+		_, w := testParse(t, filename, files[filename])
+		res = append(res, w.GetReports()...)
+	}
+	return res
+}
+
+func diffReportsStrings(t *testing.T, changes []git.Change, oldFiles, newFiles map[string]string) []string {
+	oldReports := getReportsForFiles(t, oldFiles)
+	reports := getReportsForFiles(t, newFiles)
+
+	diff, err := DiffReports("", nil, changes, nil, oldReports, reports, 1)
+	if err != nil {
+		t.Fatalf("Could not diff reports: %v", err)
+	}
+
+	var res []string
+	for _, r := range diff {
+		res = append(res, r.String())
+	}
+	sort.Strings(res)
+	return res
+}
+
+func TestDiffReportsMovedWithinFile(t *testing.T) {
+	oldFiles := map[string]string{"a.php": `<?php
+function f() {
+  return $x;
+}
+
+function g() {
+  return 1;
+}
+`}
+
+	// f() was moved after g(), diff shows it as deleted and added again
+	newFiles := map[string]string{"a.php": `<?php
+function g() {
+  return 1;
+}
+
+function f() {
+  return $x;
+}
+`}
+
+	changes := []git.Change{{
+		Type:          git.Changed,
+		OldName:       "a.php",
+		NewName:       "a.php",
+		OldLineRanges: []git.LineRange{{From: 2, To: 5, HaveRange: true, Range: 3}, {From: 8, To: 8}},
+		LineRanges:    []git.LineRange{{From: 1, To: 1, HaveRange: true, Range: 0}, {From: 5, To: 8, HaveRange: true, Range: 3}},
+		Valid:         true,
+	}}
+
+	if diff := diffReportsStrings(t, changes, oldFiles, newFiles); len(diff) != 0 {
+		t.Errorf("Unexpected new reports: %v", diff)
+	}
+}
+
+func TestDiffReportsFileSplit(t *testing.T) {
+	oldFiles := map[string]string{"a.php": `<?php
+function f() {
+  return $x;
+}
+
+function g() {
+  return $y;
+}
+`}
+
+	// f() was moved to a new file and one more problem was introduced there
+	newFiles := map[string]string{
+		"a.php": `<?php
+function g() {
+  return $y;
+}
+`,
+		"b.php": `<?php
+function f() {
+  return $x;
+}
+
+function h() {
+  return $x;
+}
+`,
+	}
+
+	changes := []git.Change{
+		{
+			Type:          git.Changed,
+			OldName:       "a.php",
+			NewName:       "a.php",
+			OldLineRanges: []git.LineRange{{From: 2, To: 5, HaveRange: true, Range: 3}},
+			LineRanges:    []git.LineRange{{From: 1, To: 1, HaveRange: true, Range: 0}},
+			Valid:         true,
+		},
+		{
+			Type:          git.Added,
+			OldName:       "/dev/null",
+			NewName:       "b.php",
+			OldLineRanges: []git.LineRange{{From: 0, To: 0, HaveRange: true, Range: 0}},
+			LineRanges:    []git.LineRange{{From: 1, To: 8, HaveRange: true, Range: 7}},
+			Valid:         true,
+		},
+	}
+
+	diff := diffReportsStrings(t, changes, oldFiles, newFiles)
+	if len(diff) != 1 || !strings.Contains(diff[0], "at b.php:7") {
+		t.Fatalf("Expected only report in h(), got %v", diff)
+	}
+}
+
+func TestReportContextHash(t *testing.T) {
+	lines := [][]byte{
+		[]byte("function f() {"),
+		[]byte(""),
+		[]byte("  return $x;"),
+		[]byte("}"),
+	}
+	reindented := [][]byte{
+		[]byte("\tfunction f() {"),
+		[]byte("\treturn $x;"),
+		[]byte(""),
+		[]byte("\t}"),
+	}
+	other := [][]byte{
+		[]byte("function g() {"),
+		[]byte("  return $x;"),
+		[]byte("}"),
+	}
+
+	h := reportContextHash(lines, 3, 3)
+	if h == 0 {
+		t.Fatalf("Unexpected zero hash")
+	}
+	if got := reportContextHash(reindented, 2, 2); got != h {
+		t.Errorf("Hash of reindented code differs: %x != %x", got, h)
+	}
+	if got := reportContextHash(other, 2, 2); got == h {
+		t.Errorf("Hash of different code is the same")
+	}
+	if got := reportContextHash(lines, 10, 10); got != 0 {
+		t.Errorf("Expected zero hash for unknown position, got %x", got)
+	}
+}
+
+func runGit(t *testing.T, dir string, args ...string) {
+	t.Helper()
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+	)
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, out)
+	}
+}
+
+// TestDiffReportsDeletedFile checks that usages of definitions from a deleted file are reported
+// in changed files when staged changes are compared with the commit that the index is built from.
+func TestDiffReportsDeletedFile(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir, err := ioutil.TempDir("", "noverify-git-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeFile := func(name, contents string) {
+		t.Helper()
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runGit(t, dir, "init", "-q")
+	writeFile("foo.php", "<?php\nfunction foo() {}\n")
+	writeFile("a.php", "<?php\nfunction a() {\n\t$x = 1;\n\tfoo();\n\treturn $x;\n}\n")
+	runGit(t, dir, "add", "-A")
+	runGit(t, dir, "commit", "-q", "-m", "initial")
+
+	runGit(t, dir, "rm", "-q", "foo.php")
+	writeFile("a.php", "<?php\nfunction a() {\n\t$x = 2;\n\tfoo();\n\treturn $x;\n}\n")
+	runGit(t, dir, "add", "a.php")
+
+	gitDir := filepath.Join(dir, ".git")
+	changes, err := git.DiffStaged(gitDir, "HEAD")
+	if err != nil {
+		t.Fatalf("Could not compute diff: %v", err)
+	}
+
+	testParse(t, "init.php", `<?php`) // starts memory limiter
+
+	defer func() {
+		MaxConcurrency = 0
+		meta.ResetInfo()
+		meta.SetIndexingComplete(false)
+	}()
+	MaxConcurrency = 1
+
+	// the same steps as in -git-staged mode
+	meta.ResetInfo()
+	ParseFilenames(ReadFilesFromGit(gitDir, "HEAD", nil))
+	meta.SetIndexingComplete(true)
+	oldReports := ParseFilenames(ReadOldFilesFromGit(gitDir, "HEAD", changes))
+
+	meta.SetIndexingComplete(false)
+	ParseFilenames(ReadChangesFromIndex(gitDir, changes))
+	meta.SetIndexingComplete(true)
+	reports := ParseFilenames(ReadChangesFromIndex(gitDir, changes))
+
+	diff, err := DiffReports(gitDir, nil, changes, nil, oldReports, reports, 1)
+	if err != nil {
+		t.Fatalf("Could not diff reports: %v", err)
+	}
+
+	var found bool
+	for _, r := range diff {
+		if strings.Contains(r.String(), "Call to undefined function foo") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("No report about undefined function foo in %v", diff)
+	}
+}
+
+func TestReportEndSourceLine(t *testing.T) {
+	reports := getReportsSimple(t, "<?php\nfunction f() {\n\treturn array(\n\t\t1\n\t) + array(1);\n}\n")
+
+	var multiline, single *Report
+	for _, r := range reports {
+		if r.CheckName() != "arraySyntax" {
+			continue
+		}
+		if r.StartLine() == 3 {
+			multiline = r
+		} else {
+			single = r
+		}
+	}
+	if multiline == nil || single == nil {
+		t.Fatalf("No reports about array syntax in %v", reports)
+	}
+
+	data, err := json.Marshal(multiline)
+	if err != nil {
+		t.Fatalf("Could not encode report: %v", err)
+	}
+	var decoded Report
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Could not decode report: %v", err)
+	}
+
+	for _, r := range []*Report{multiline, &decoded} {
+		if r.EndLine() != 5 || r.EndSourceLine() != "\t) + array(1);" {
+			t.Errorf("Expected report to end at line 5 %q, got line %d %q", "\t) + array(1);", r.EndLine(), r.EndSourceLine())
+		}
+	}
+
+	if single.EndSourceLine() != single.SourceLine() {
+		t.Errorf("Single line report ends at %q, expected %q", single.EndSourceLine(), single.SourceLine())
+	}
+}
@@ -2,6 +2,7 @@ package linter
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"log"
 	"strconv"
@@ -45,6 +46,9 @@ type RootWalker struct {
 
 	lineRanges []git.LineRange
 
+	// "noverify-ignore" directives found in the file
+	suppressions []*suppression
+
 	custom      []RootChecker
 	customBlock []BlockCheckerCreateFunc
 	customState map[string]interface{}
@@ -60,6 +64,7 @@ type RootWalker struct {
 	reports []*Report
 
 	// state required for both language server and reports creation
+	contents       []byte
 	Positions      position.Positions
 	Lines          [][]byte
 	LinesPositions []int
@@ -67,6 +72,7 @@ type RootWalker struct {
 	// exposed meta-information for language server to use
 	Scopes      map[node.Node]*meta.Scope
 	Diagnostics []vscode.Diagnostic
+	Fixes       []DiagnosticFix
 }
 
 // Report is a linter report message.
@@ -74,12 +80,19 @@ type Report struct {
 	checkName  string
 	startLn    string
 	startChar  int
+	endLn      string // only set when reported code spans several lines
 	startLine  int
+	endLine    int
 	endChar    int
 	level      int
 	msg        string
 	filename   string
 	isDisabled bool // user-defined flag that file should not be linted
+	fix        *Fix
+	contents   []byte
+	commit     *git.Commit
+
+	contextHash uint64 // see reportContextHash
 }
 
 // CheckName returns report associated check name.
@@ -126,6 +139,144 @@ func (r *Report) GetFilename() string {
 	return r.filename
 }
 
+// Level returns report severity level (one of Level* constants).
+func (r *Report) Level() int {
+	return r.level
+}
+
+// Message returns formatted report message without check name.
+func (r *Report) Message() string {
+	return r.msg
+}
+
+// StartLine returns 1-based line number where reported code starts.
+func (r *Report) StartLine() int {
+	return r.startLine
+}
+
+// EndLine returns 1-based line number where reported code ends.
+func (r *Report) EndLine() int {
+	return r.endLine
+}
+
+// StartChar returns 0-based byte offset in the start line where reported code starts.
+func (r *Report) StartChar() int {
+	return r.startChar
+}
+
+// EndChar returns 0-based byte offset in the end line where reported code ends.
+func (r *Report) EndChar() int {
+	return r.endChar
+}
+
+// SourceLine returns contents of the line where reported code starts.
+func (r *Report) SourceLine() string {
+	return r.startLn
+}
+
+// EndSourceLine returns contents of the line where reported code ends.
+func (r *Report) EndSourceLine() string {
+	if r.endLine == r.startLine {
+		return r.startLn
+	}
+	return r.endLn
+}
+
+// Fix returns automatic fix for the report or nil if there is none.
+func (r *Report) Fix() *Fix {
+	return r.fix
+}
+
+// FileContents returns contents of the analyzed file (converted to UTF-8).
+// It is nil unless KeepReportsContents is set.
+func (r *Report) FileContents() []byte {
+	return r.contents
+}
+
+// Commit returns the commit that changed reported line according to git blame.
+// It is only set by DiffReports, and only when the commit is known, otherwise it is nil.
+func (r *Report) Commit() *git.Commit {
+	return r.commit
+}
+
+// reportJSON is used to pass reports between processes and to keep them in cache.
+type reportJSON struct {
+	CheckName  string      `json:"check_name"`
+	StartLn    string      `json:"start_ln"`
+	StartChar  int         `json:"start_char"`
+	EndLn      string      `json:"end_ln,omitempty"`
+	StartLine  int         `json:"start_line"`
+	EndLine    int         `json:"end_line"`
+	EndChar    int         `json:"end_char"`
+	Level      int         `json:"level"`
+	Msg        string      `json:"msg"`
+	Filename   string      `json:"filename"`
+	IsDisabled bool        `json:"is_disabled,omitempty"`
+	Fix        *Fix        `json:"fix,omitempty"`
+	Contents   []byte      `json:"contents,omitempty"`
+	Commit     *git.Commit `json:"commit,omitempty"`
+
+	ContextHash uint64 `json:"context_hash,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (r *Report) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.toJSON())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (r *Report) UnmarshalJSON(data []byte) error {
+	var j reportJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+
+	*r = *j.toReport()
+	return nil
+}
+
+func (r *Report) toJSON() *reportJSON {
+	return &reportJSON{
+		CheckName:  r.checkName,
+		StartLn:    r.startLn,
+		StartChar:  r.startChar,
+		EndLn:      r.endLn,
+		StartLine:  r.startLine,
+		EndLine:    r.endLine,
+		EndChar:    r.endChar,
+		Level:      r.level,
+		Msg:        r.msg,
+		Filename:   r.filename,
+		IsDisabled: r.isDisabled,
+		Fix:        r.fix,
+		Contents:   r.contents,
+		Commit:     r.commit,
+
+		ContextHash: r.contextHash,
+	}
+}
+
+func (j *reportJSON) toReport() *Report {
+	return &Report{
+		checkName:  j.CheckName,
+		startLn:    j.StartLn,
+		startChar:  j.StartChar,
+		endLn:      j.EndLn,
+		startLine:  j.StartLine,
+		endLine:    j.EndLine,
+		endChar:    j.EndChar,
+		level:      j.Level,
+		msg:        j.Msg,
+		filename:   j.Filename,
+		isDisabled: j.IsDisabled,
+		fix:        j.Fix,
+		contents:   j.Contents,
+		commit:     j.Commit,
+
+		contextHash: j.ContextHash,
+	}
+}
+
 type phpDocParamEl struct {
 	optional bool
 	typ      *meta.TypesMap
@@ -135,8 +286,9 @@ type phpDocParamsMap map[string]phpDocParamEl
 
 // NewWalkerForLangServer creates a copy of RootWalker to make full analysis of a file
 func NewWalkerForLangServer(prev *RootWalker) *RootWalker {
-	return &RootWalker{
+	d := &RootWalker{
 		filename:       prev.filename,
+		contents:       prev.contents,
 		Positions:      prev.Positions,
 		comments:       prev.comments,
 		LinesPositions: prev.LinesPositions,
@@ -144,6 +296,8 @@ func NewWalkerForLangServer(prev *RootWalker) *RootWalker {
 		lineRanges:     prev.lineRanges,
 		st:             &meta.ClassParseState{},
 	}
+	d.initLineSuppressions()
+	return d
 }
 
 // NewWalkerForReferencesSearcher allows to access full context of a parser so that we can perform complex
@@ -167,10 +321,13 @@ func (d *RootWalker) InitFromParser(contents []byte, parser *php7.Parser) {
 		pos += len(ln) + 1
 	}
 
+	d.contents = contents
 	d.Positions = parser.GetPositions()
 	d.comments = parser.GetComments()
 	d.LinesPositions = linesPositions
 	d.Lines = lines
+
+	d.initLineSuppressions()
 }
 
 // InitCustom is needed to initialize walker state
@@ -230,6 +387,19 @@ func (d *RootWalker) EnterNode(w walker.Walkable) (res bool) {
 
 	state.EnterNode(d.st, w)
 
+	switch n := w.(type) {
+	case *stmt.Class:
+		d.addPHPDocSuppressions(n, n.PhpDocComment)
+	case *stmt.Interface:
+		d.addPHPDocSuppressions(n, n.PhpDocComment)
+	case *stmt.Trait:
+		d.addPHPDocSuppressions(n, n.PhpDocComment)
+	case *stmt.Function:
+		d.addPHPDocSuppressions(n, n.PhpDocComment)
+	case *stmt.ClassMethod:
+		d.addPHPDocSuppressions(n, n.PhpDocComment)
+	}
+
 	switch n := w.(type) {
 	case *stmt.Interface:
 		d.currentClassNode = n
@@ -294,6 +464,11 @@ func (d *RootWalker) parseStartPos(pos *position.Position) (startLn []byte, star
 
 // Report registers a single report message about some found problem.
 func (d *RootWalker) Report(n node.Node, level int, checkName, msg string, args ...interface{}) {
+	d.ReportWithFix(n, level, checkName, nil, msg, args...)
+}
+
+// ReportWithFix registers a report with an automatic fix. Fix can be nil.
+func (d *RootWalker) ReportWithFix(n node.Node, level int, checkName string, fix *Fix, msg string, args ...interface{}) {
 	if !meta.IsIndexingComplete() {
 		return
 	}
@@ -321,6 +496,22 @@ func (d *RootWalker) Report(n node.Node, level int, checkName, msg string, args
 		pos = *d.Positions[n]
 	}
 
+	if d.isSuppressed(checkName, pos.StartLine) {
+		return
+	}
+
+	d.reportPos(pos, level, checkName, fix, msg, args...)
+}
+
+// reportPos registers a report at the specified position. Suppressions are not checked here.
+func (d *RootWalker) reportPos(pos position.Position, level int, checkName string, fix *Fix, msg string, args ...interface{}) {
+	if cfg := projectConfig; cfg != nil {
+		if !cfg.IsCheckEnabled(d.filename, checkName) {
+			return
+		}
+		level = cfg.CheckSeverity(d.filename, checkName, level)
+	}
+
 	var endLn []byte
 	var endChar int
 
@@ -358,19 +549,37 @@ func (d *RootWalker) Report(n node.Node, level int, checkName, msg string, args
 			}
 
 			d.Diagnostics = append(d.Diagnostics, diag)
+			if fix != nil {
+				d.Fixes = append(d.Fixes, DiagnosticFix{Diagnostic: diag, Fix: fix})
+			}
 		}
 	} else {
-		d.reports = append(d.reports, &Report{
+		var contents []byte
+		if KeepReportsContents {
+			contents = d.contents
+		}
+
+		r := &Report{
 			checkName:  checkName,
 			startLn:    string(startLn),
 			startChar:  startChar,
 			startLine:  pos.StartLine,
+			endLine:    pos.EndLine,
 			endChar:    endChar,
 			level:      level,
 			filename:   d.filename,
 			msg:        fmt.Sprintf(msg, args...),
 			isDisabled: d.disabledFlag,
-		})
+			fix:        fix,
+			contents:   contents,
+
+			contextHash: reportContextHash(d.Lines, pos.StartLine, pos.EndLine),
+		}
+		if pos.EndLine != pos.StartLine {
+			r.endLn = string(endLn)
+		}
+
+		d.reports = append(d.reports, r)
 	}
 }
 
@@ -0,0 +1,162 @@
+package linter
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/VKCOM/noverify/src/lintdebug"
+	"github.com/VKCOM/noverify/src/meta"
+)
+
+var errStubsChanged = errors.New("stubs directory has changed")
+
+// stubsSnapshot is the contents of StubsSnapshot file after the version byte.
+type stubsSnapshot struct {
+	Fingerprint string
+	Meta        *meta.Snapshot
+}
+
+// InitStubs parses directory with PHPStorm stubs which has all internal PHP classes and functions declared.
+//
+// If StubsSnapshot is set, meta info is loaded from it instead. Snapshot that does not exist
+// or does not match contents of StubsDir is written again after stubs are parsed.
+func InitStubs() {
+	if StubsSnapshot == "" {
+		ParseFilenames(ReadFilenames([]string{StubsDir}, nil))
+		meta.Info.InitStubs()
+		return
+	}
+
+	fingerprint, err := stubsFingerprint()
+	if err != nil {
+		log.Fatalf("Could not read stubs: %s", err.Error())
+	}
+
+	start := time.Now()
+	if err := loadStubsSnapshot(StubsSnapshot, fingerprint); err == nil {
+		lintdebug.Send("Loaded stubs snapshot %s in %s", StubsSnapshot, time.Since(start))
+		meta.Info.InitStubs()
+		return
+	} else if !os.IsNotExist(err) {
+		log.Printf("Stubs snapshot %s is not used: %s", StubsSnapshot, err.Error())
+	}
+
+	ParseFilenames(ReadFilenames([]string{StubsDir}, nil))
+	meta.Info.InitStubs()
+
+	if err := writeStubsSnapshot(StubsSnapshot, fingerprint); err != nil {
+		log.Printf("Could not write stubs snapshot %s: %s", StubsSnapshot, err.Error())
+	}
+}
+
+// WriteStubsSnapshot parses StubsDir and writes its meta info to the specified file,
+// so that it can be used as StubsSnapshot. Meta info must not have anything except stubs.
+func WriteStubsSnapshot(filename string) error {
+	fingerprint, err := stubsFingerprint()
+	if err != nil {
+		return err
+	}
+
+	ParseFilenames(ReadFilenames([]string{StubsDir}, nil))
+	meta.Info.InitStubs()
+
+	return writeStubsSnapshot(filename, fingerprint)
+}
+
+// stubsFingerprint returns a string that changes whenever contents of files that are parsed
+// as stubs change, or when they are parsed differently.
+func stubsFingerprint() (string, error) {
+	dir, err := filepath.Abs(StubsDir)
+	if err != nil {
+		return "", err
+	}
+
+	h := md5.New()
+	fmt.Fprintf(h, "%s\x00%s\x00", dir, DefaultEncoding)
+
+	// the same files as ReadFilenames returns
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !strings.HasSuffix(path, ".php") || info.IsDir() {
+			return nil
+		}
+
+		fp, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer fp.Close()
+
+		fmt.Fprintf(h, "%s\x00%d\x00", path, info.Size())
+		_, err = io.Copy(h, fp)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+func writeStubsSnapshot(filename, fingerprint string) error {
+	meta.Info.Lock()
+	defer meta.Info.Unlock()
+
+	var buf bytes.Buffer
+	buf.WriteByte(cacheVersion)
+
+	s := &stubsSnapshot{
+		Fingerprint: fingerprint,
+		Meta:        meta.Info.SnapshotNonLocked(),
+	}
+	if err := gob.NewEncoder(&buf).Encode(s); err != nil {
+		return err
+	}
+
+	return writeFileAtomic(filename, buf.Bytes())
+}
+
+// loadStubsSnapshot adds meta info from the snapshot file if it was written for stubs with the specified fingerprint.
+func loadStubsSnapshot(filename, fingerprint string) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	rd := bufio.NewReader(bytes.NewReader(data))
+
+	if ver, err := rd.ReadByte(); err != nil || ver != cacheVersion {
+		return errWrongVersion
+	}
+
+	var s stubsSnapshot
+	if err := gob.NewDecoder(rd).Decode(&s); err != nil {
+		return err
+	}
+
+	if s.Fingerprint != fingerprint {
+		return errStubsChanged
+	}
+	if s.Meta == nil {
+		return errors.New("snapshot has no meta info")
+	}
+
+	meta.Info.Lock()
+	defer meta.Info.Unlock()
+
+	meta.Info.RestoreSnapshotNonLocked(s.Meta)
+	return nil
+}
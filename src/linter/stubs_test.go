@@ -0,0 +1,105 @@
+package linter
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/VKCOM/noverify/src/meta"
+)
+
+func TestStubsSnapshot(t *testing.T) {
+	dir := newTestCacheDir(t)
+	defer os.RemoveAll(dir)
+
+	writeStub := func(name, contents string) {
+		t.Helper()
+		if err := ioutil.WriteFile(filepath.Join(dir, "stubs", name), []byte(contents), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.Mkdir(filepath.Join(dir, "stubs"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	writeStub("a.php", `<?php
+	/** @return int */
+	function strlen($s) {}
+	class Exception {
+		protected $message;
+		public function getMessage() {}
+	}
+	define('PHP_EOL', "\n");
+	$_SERVER = [];`)
+	writeStub(".phpstorm.meta.php", `<?php
+	namespace PHPSTORM_META {
+		override(\array_shift(0), elementType(0));
+	}`)
+
+	testParse(t, "init.php", `<?php`) // starts memory limiter
+
+	defer func() {
+		StubsDir = ""
+		StubsSnapshot = ""
+		MaxConcurrency = 0
+		meta.ResetInfo()
+		meta.Info.InitStubs()
+	}()
+
+	StubsDir = filepath.Join(dir, "stubs")
+	StubsSnapshot = filepath.Join(dir, "stubs.snapshot")
+	MaxConcurrency = 1
+
+	meta.ResetInfo()
+	InitStubs()
+	// gob does not keep difference between nil and empty maps, so formatted meta info is compared
+	expected := fmt.Sprintf("%+v", meta.Info.SnapshotNonLocked())
+
+	if _, ok := meta.GetInternalFunctionInfo(`\strlen`); !ok {
+		t.Fatalf("Stubs were not parsed")
+	}
+	if _, err := os.Stat(StubsSnapshot); err != nil {
+		t.Fatalf("Snapshot was not written: %v", err)
+	}
+
+	fingerprint, err := stubsFingerprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	meta.ResetInfo()
+	if err := loadStubsSnapshot(StubsSnapshot, fingerprint); err != nil {
+		t.Fatalf("Could not load snapshot: %v", err)
+	}
+	if s := fmt.Sprintf("%+v", meta.Info.SnapshotNonLocked()); s != expected {
+		t.Errorf("Loaded meta info %s differs from parsed %s", s, expected)
+	}
+
+	writeStub("b.php", `<?php
+	function strrev($s) {}`)
+
+	newFingerprint, err := stubsFingerprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	meta.ResetInfo()
+	if err := loadStubsSnapshot(StubsSnapshot, newFingerprint); err != errStubsChanged {
+		t.Errorf("Snapshot of changed stubs was loaded, error: %v", err)
+	}
+
+	InitStubs()
+	if _, ok := meta.GetInternalFunctionInfo(`\strrev`); !ok {
+		t.Errorf("Changed stubs were not parsed")
+	}
+
+	meta.ResetInfo()
+	if err := loadStubsSnapshot(StubsSnapshot, newFingerprint); err != nil {
+		t.Errorf("Snapshot was not written again for changed stubs: %v", err)
+	}
+	if _, ok := meta.Info.GetFunction(`\strrev`); !ok {
+		t.Errorf("Loaded snapshot has no functions from changed stubs")
+	}
+}
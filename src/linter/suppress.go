@@ -0,0 +1,257 @@
+package linter
+
+import (
+	"bytes"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/VKCOM/noverify/src/phpdoc"
+	"github.com/z7zmey/php-parser/node"
+	"github.com/z7zmey/php-parser/position"
+	"github.com/z7zmey/php-parser/scanner"
+	"github.com/z7zmey/php-parser/token"
+)
+
+const (
+	// IgnoreDirective suppresses reports on the same line or on the next line if written on a separate line:
+	//	// noverify-ignore checkName: reason
+	IgnoreDirective = "noverify-ignore"
+
+	unusedIgnoreCheckName = "unusedIgnore"
+)
+
+var ignoreDirectiveRegex = regexp.MustCompile(`^(?://|#|/\*)\s*` + IgnoreDirective + `(?:\s+([\w\s,]*?))?\s*(?::|\*/|$)`)
+
+// suppression disables reports of a single check (or all checks if checkName is empty)
+// in lines range [fromLine, toLine].
+type suppression struct {
+	checkName string
+	fromLine  int
+	toLine    int
+
+	// position of the directive itself, used to report unused suppressions
+	line      int
+	startChar int
+	isPHPDoc  bool
+
+	used bool
+}
+
+// parseIgnoreCheckNames returns list of check names in "undefined,caseBreak:" form.
+// Empty check name means that all checks are suppressed.
+func parseIgnoreCheckNames(s string) []string {
+	s = strings.TrimSuffix(strings.TrimSpace(s), ":")
+
+	var res []string
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			res = append(res, name)
+		}
+	}
+
+	if len(res) == 0 {
+		return []string{""}
+	}
+
+	return res
+}
+
+// initLineSuppressions finds all "// noverify-ignore" comments in the file.
+func (d *RootWalker) initLineSuppressions() {
+	d.suppressions = nil
+
+	if !bytes.Contains(d.contents, []byte(IgnoreDirective)) {
+		return
+	}
+
+	for _, c := range findComments(d.contents) {
+		text := d.contents[c.start:c.end]
+		if idx := bytes.IndexByte(text, '\n'); idx >= 0 {
+			text = text[:idx] // directive must be on the first line of the comment
+		}
+		text = bytes.TrimRight(text, "\r")
+
+		m := ignoreDirectiveRegex.FindSubmatchIndex(text)
+		if m == nil {
+			continue
+		}
+
+		idx := sort.Search(len(d.LinesPositions), func(i int) bool { return d.LinesPositions[i] > c.start }) - 1
+		if idx < 0 {
+			continue
+		}
+
+		line := idx + 1
+		startChar := c.start - d.LinesPositions[idx]
+		target := line
+		if len(bytes.TrimSpace(d.Lines[idx][:startChar])) == 0 {
+			target = line + 1 // comment on a separate line applies to the next one
+		}
+
+		var names string
+		if m[2] >= 0 {
+			names = string(text[m[2]:m[3]])
+		}
+
+		for _, checkName := range parseIgnoreCheckNames(names) {
+			d.suppressions = append(d.suppressions, &suppression{
+				checkName: checkName,
+				fromLine:  target,
+				toLine:    target,
+				line:      line,
+				startChar: startChar,
+			})
+		}
+	}
+}
+
+// commentPos is a position of a comment in file contents, end is exclusive.
+type commentPos struct {
+	start int
+	end   int
+}
+
+// tokenRecorder keeps the last token passed by the lexer.
+type tokenRecorder struct {
+	last token.Token
+}
+
+func (r *tokenRecorder) Token(t token.Token) {
+	r.last = t
+}
+
+// findComments returns positions of all comments in the file. Lexer does not report positions
+// of comments, but it reports comments that precede every token, so they are looked up
+// in the contents between tokens, where there is nothing else except whitespace.
+func findComments(contents []byte) []commentPos {
+	var res []commentPos
+
+	lexer := scanner.NewLexer(bytes.NewReader(contents), "")
+	var lval tokenRecorder
+
+	prevEnd := 0
+	for {
+		tok := lexer.Lex(&lval)
+
+		gapEnd := len(contents)
+		if tok > 0 && lval.last.StartPos >= 1 && lval.last.StartPos-1 <= len(contents) {
+			gapEnd = lval.last.StartPos - 1
+		}
+
+		cursor := prevEnd
+		for _, c := range lexer.Comments {
+			if cursor > gapEnd {
+				break
+			}
+			text := strings.TrimRight(c.String(), "\r\n")
+			idx := bytes.Index(contents[cursor:gapEnd], []byte(text))
+			if idx < 0 {
+				continue // e.g. invalid UTF-8 that was replaced by lexer
+			}
+			start := cursor + idx
+			res = append(res, commentPos{start: start, end: start + len(text)})
+			cursor = start + len(text)
+		}
+
+		if tok <= 0 { // EOF
+			break
+		}
+		if lval.last.EndPos > prevEnd {
+			prevEnd = lval.last.EndPos
+		}
+	}
+
+	return res
+}
+
+// addPHPDocSuppressions handles "@noverify-ignore checkName" in PHPDoc of a function or a class:
+// reports are suppressed in the whole definition.
+func (d *RootWalker) addPHPDocSuppressions(n node.Node, doc string) {
+	if !strings.Contains(doc, IgnoreDirective) {
+		return
+	}
+
+	pos := d.Positions[n]
+	if pos == nil {
+		return
+	}
+
+	for _, part := range phpdoc.Parse(doc) {
+		if part.Name != IgnoreDirective {
+			continue
+		}
+
+		// "@noverify-ignore a, b: reason" is split into {"a,", "b:", "reason"}
+		var names string
+		for _, p := range part.Params {
+			names += p
+			if !strings.HasSuffix(p, ",") {
+				break
+			}
+		}
+
+		for _, checkName := range parseIgnoreCheckNames(names) {
+			d.suppressions = append(d.suppressions, &suppression{
+				checkName: checkName,
+				fromLine:  pos.StartLine,
+				toLine:    pos.EndLine,
+				line:      pos.StartLine,
+				isPHPDoc:  true,
+			})
+		}
+	}
+}
+
+// isSuppressed reports whether or not report of checkName at the specified line is suppressed.
+// All matching suppressions are marked as used.
+func (d *RootWalker) isSuppressed(checkName string, line int) bool {
+	suppressed := false
+
+	for _, s := range d.suppressions {
+		if line < s.fromLine || line > s.toLine {
+			continue
+		}
+
+		if s.checkName == "" || s.checkName == checkName {
+			s.used = true
+			suppressed = true
+		}
+	}
+
+	return suppressed
+}
+
+// ReportUnusedSuppressions reports "noverify-ignore" directives that did not suppress anything.
+// It must be called after the whole file has been analyzed.
+func (d *RootWalker) ReportUnusedSuppressions() {
+	for _, s := range d.suppressions {
+		if s.used {
+			continue
+		}
+
+		what := "all checks"
+		if s.checkName != "" {
+			what = s.checkName
+		}
+
+		if s.isPHPDoc {
+			d.reportPos(d.linePosition(s.line, 0), LevelWarning, unusedIgnoreCheckName, nil, "Unused @%s for %s", IgnoreDirective, what)
+		} else {
+			d.reportPos(d.linePosition(s.line, s.startChar), LevelWarning, unusedIgnoreCheckName, nil, "Unused %s for %s", IgnoreDirective, what)
+		}
+	}
+}
+
+// linePosition returns position that spans the specified line starting from startChar.
+func (d *RootWalker) linePosition(line, startChar int) position.Position {
+	pos := position.Position{StartLine: line, EndLine: line}
+
+	if line >= 1 && len(d.LinesPositions) >= line {
+		p := d.LinesPositions[line-1]
+		pos.StartPos = p + startChar + 1
+		pos.EndPos = p + len(d.Lines[line-1])
+	}
+
+	return pos
+}
@@ -1,6 +1,7 @@
 package meta
 
 import (
+	"sort"
 	"strings"
 	"sync"
 
@@ -125,6 +126,31 @@ func (i *info) FindConstants(substr string) (res []string) {
 	return res
 }
 
+// AllClassesNonLocked returns all classes and interfaces. Returned map must not be modified.
+func (i *info) AllClassesNonLocked() ClassesMap {
+	return i.allClasses
+}
+
+// AllTraitsNonLocked returns all traits. Returned map must not be modified.
+func (i *info) AllTraitsNonLocked() TraitsMap {
+	return i.allTraits
+}
+
+// AllFunctionsNonLocked returns all functions. Returned map must not be modified.
+func (i *info) AllFunctionsNonLocked() FunctionsMap {
+	return i.allFunctions
+}
+
+// AllConstantsNonLocked returns all constants. Returned map must not be modified.
+func (i *info) AllConstantsNonLocked() ConstantsMap {
+	return i.allConstants
+}
+
+// AllFunctionsOverridesNonLocked returns all function return type overrides. Returned map must not be modified.
+func (i *info) AllFunctionsOverridesNonLocked() FunctionsOverrideMap {
+	return i.allFunctionsOverrides
+}
+
 func (i *info) InitStubs() {
 	i.Lock()
 	defer i.Unlock()
@@ -145,6 +171,52 @@ func (i *info) InitStubs() {
 	}
 }
 
+// Snapshot is meta information in a form that can be serialized, e.g. to skip parsing of stubs.
+type Snapshot struct {
+	Files             []string
+	PerFile           map[string]PerFile
+	FunctionOverrides FunctionsOverrideMap
+	Scope             *Scope
+}
+
+// SnapshotNonLocked returns current meta information. Returned snapshot shares maps with meta info
+// and must not be modified.
+func (i *info) SnapshotNonLocked() *Snapshot {
+	s := &Snapshot{
+		PerFile:           make(map[string]PerFile, len(i.allFiles)),
+		FunctionOverrides: i.allFunctionsOverrides,
+		Scope:             i.Scope,
+	}
+
+	for filename := range i.allFiles {
+		s.Files = append(s.Files, filename)
+		s.PerFile[filename] = i.GetMetaForFile(filename)
+	}
+	sort.Strings(s.Files)
+
+	return s
+}
+
+// RestoreSnapshotNonLocked adds meta information from the snapshot in the same way as if its files were parsed.
+func (i *info) RestoreSnapshotNonLocked(s *Snapshot) {
+	for _, filename := range s.Files {
+		m := s.PerFile[filename]
+
+		i.DeleteMetaForFileNonLocked(filename)
+		i.AddFilenameNonLocked(filename)
+		i.AddClassesNonLocked(filename, m.Classes)
+		i.AddTraitsNonLocked(filename, m.Traits)
+		i.AddFunctionsNonLocked(filename, m.Functions)
+		i.AddConstantsNonLocked(filename, m.Constants)
+	}
+
+	i.AddFunctionsOverridesNonLocked("", s.FunctionOverrides)
+
+	if s.Scope != nil {
+		i.AddToGlobalScopeNonLocked("", s.Scope)
+	}
+}
+
 func (i *info) AddFilenameNonLocked(filename string) {
 	i.allFiles[filename] = true
 }
@@ -367,6 +439,17 @@ func GetInternalFunctionOverrideInfo(fn string) (info FuncInfoOverride, ok bool)
 	return info, ok
 }
 
+// InternalFunctions returns functions that were declared in stubs. Returned map must not be modified.
+func InternalFunctions() FunctionsMap {
+	return internalFunctions
+}
+
+// InternalFunctionOverrides returns function return type overrides that were declared in stubs.
+// Returned map must not be modified.
+func InternalFunctionOverrides() FunctionsOverrideMap {
+	return internalFunctionOverrides
+}
+
 var onCompleteCallbacks []func()
 
 func OnIndexingComplete(cb func()) {
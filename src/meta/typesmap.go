@@ -365,6 +365,11 @@ func (m *TypesMap) Append(n *TypesMap) *TypesMap {
 	return &TypesMap{m: mm}
 }
 
+// FormatType returns human-readable representation of a type, e.g. "\Foo::bar()" for a lazy static method call type.
+func FormatType(s string) string {
+	return formatType(s)
+}
+
 func formatType(s string) (res string) {
 	if len(s) == 0 || s[0] >= WMax {
 		return s
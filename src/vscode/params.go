@@ -98,3 +98,13 @@ type FileEvent struct {
 type DidChangeWatchedFilesParams struct {
 	Changes []FileEvent `json:"changes"`
 }
+
+type CodeActionParams struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+	Range   Range `json:"range"`
+	Context struct {
+		Diagnostics []Diagnostic `json:"diagnostics"`
+	} `json:"context"`
+}
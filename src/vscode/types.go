@@ -207,3 +207,46 @@ const (
 	SymbolKindBoolean     = 17
 	SymbolKindArray       = 18
 )
+
+type TextEdit struct {
+	/**
+	 * The range of the text document to be manipulated. To insert
+	 * text into a document create a range where start === end.
+	 */
+	Range Range `json:"range"`
+
+	/**
+	 * The string to be inserted. For delete operations use an
+	 * empty string.
+	 */
+	NewText string `json:"newText"`
+}
+
+type WorkspaceEdit struct {
+	/**
+	 * Holds changes to existing resources.
+	 */
+	Changes map[string][]TextEdit `json:"changes"`
+}
+
+type CodeAction struct {
+	/**
+	 * A short, human-readable, title for this code action.
+	 */
+	Title string `json:"title"`
+
+	/**
+	 * The kind of the code action, e.g. "quickfix".
+	 */
+	Kind string `json:"kind,omitempty"`
+
+	/**
+	 * The diagnostics that this code action resolves.
+	 */
+	Diagnostics []Diagnostic `json:"diagnostics,omitempty"`
+
+	/**
+	 * The workspace edit this code action performs.
+	 */
+	Edit *WorkspaceEdit `json:"edit,omitempty"`
+}